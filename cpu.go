@@ -2,41 +2,89 @@ package system
 
 import (
 	"bufio"
+	"errors"
 	"io"
+	"math"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 	"fmt"
 )
 
 //CPU型号
 func CpuModel(args string) string {
-	return ExecOutput("cat /proc/cpuinfo | grep name | cut -f2 -d: | uniq")
+	content, err := GetFileContent(ProcPath("", "cpuinfo"))
+	if err != nil {
+		return ""
+	}
+	//与grep name | cut -f2 -d: | uniq一致, 相邻重复的型号只保留一个
+	models := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.Contains(line, "name") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 {
+			continue
+		}
+		if len(models) > 0 && models[len(models)-1] == fields[1] {
+			continue
+		}
+		models = append(models, fields[1])
+	}
+	return strings.TrimSpace(strings.Join(models, ""))
 }
 
 //逻辑CPU个数
 func CpuNum(args string) string {
-	return ExecOutput("cat /proc/cpuinfo | grep processor | wc -l")
+	content, err := GetFileContent(ProcPath("", "cpuinfo"))
+	if err != nil {
+		return ""
+	}
+	num := 0
+	for _, line := range strings.Split(content, "\n") {
+		if strings.Contains(line, "processor") {
+			num++
+		}
+	}
+	return strconv.Itoa(num)
 }
 
 type Cpu struct {
-	User                uint64  //从系统启动开始累计到当前时刻，用户态的CPU时间（单位：jiffies） ，不包含 nice值为负进程。1jiffies=0.01秒
-	Nice                uint64  //从系统启动开始累计到当前时刻，nice值为负的进程所占用的CPU时间（单位：jiffies）
-	System              uint64  //从系统启动开始累计到当前时刻，内核态时间（单位：jiffies）
-	Idle                uint64  //从系统启动开始累计到当前时刻，除硬盘IO等待时间以外其它等待时间（单位：jiffies)
-	Iowait              uint64  //从系统启动开始累计到当前时刻，硬盘IO等待时间（单位：jiffies）
-	Irq                 uint64  //从系统启动开始累计到当前时刻，硬中断时间（单位：jiffies）
-	SoftIrq             uint64  //从系统启动开始累计到当前时刻，软中断时间（单位：jiffies）
-	Total               uint64  //user + nice + system + idle + iowait
-	IoWaitRate          float64 //io等待时间百分比
-	SystemRate          float64 //内核态时间百分比
-	UserRate            float64 //用户态时间百分比
-	IdleRate            float64 //空闲时间百分比
-	ProcsBlocked        uint64  //阻塞进程数
-	ProcsRunning        uint64  //运行进程数
-	IdleRateSum10       float64 //空闲时间百分比10分钟累加和
-	IdleRateSum10Times  int     //空闲时间百分比10分钟累加次数
-	IdleRate10          float64 //空闲时间10分钟环比
+	User                uint64    //从系统启动开始累计到当前时刻，用户态的CPU时间（单位：jiffies） ，不包含 nice值为负进程。1jiffies=0.01秒
+	Nice                uint64    //从系统启动开始累计到当前时刻，nice值为负的进程所占用的CPU时间（单位：jiffies）
+	System              uint64    //从系统启动开始累计到当前时刻，内核态时间（单位：jiffies）
+	Idle                uint64    //从系统启动开始累计到当前时刻，除硬盘IO等待时间以外其它等待时间（单位：jiffies)
+	Iowait              uint64    //从系统启动开始累计到当前时刻，硬盘IO等待时间（单位：jiffies）
+	Irq                 uint64    //从系统启动开始累计到当前时刻，硬中断时间（单位：jiffies）
+	SoftIrq             uint64    //从系统启动开始累计到当前时刻，软中断时间（单位：jiffies）
+	Steal               uint64    //从系统启动开始累计到当前时刻，虚拟机中被宿主机其他虚拟机占用的时间（单位：jiffies）
+	Guest               uint64    //从系统启动开始累计到当前时刻，运行虚拟机的时间，已包含在User中（单位：jiffies）
+	GuestNice           uint64    //从系统启动开始累计到当前时刻，运行nice值为负的虚拟机的时间，已包含在Nice中（单位：jiffies）
+	Total               uint64    //user + nice + system + idle + iowait + irq + softirq + steal
+	IoWaitRate          float64   //io等待时间百分比
+	SystemRate          float64   //内核态时间百分比
+	UserRate            float64   //用户态时间百分比
+	IdleRate            float64   //空闲时间百分比
+	NiceRate            float64   //nice值为负的进程时间百分比
+	IrqRate             float64   //硬中断时间百分比
+	SoftIrqRate         float64   //软中断时间百分比
+	StealRate           float64   //被宿主机占用时间百分比, 虚拟机上cpu不足时升高
+	GuestRate           float64   //运行虚拟机时间百分比
+	ProcsBlocked        uint64    //阻塞进程数
+	ProcsRunning        uint64    //运行进程数
+	Ctxt                uint64    //从系统启动开始累计的上下文切换次数
+	Intr                uint64    //从系统启动开始累计的中断次数
+	Processes           uint64    //从系统启动开始累计创建的进程数(fork)
+	Btime               uint64    //开机时间(unix时间戳)
+	CtxtPerSecond       float64   //一个周期平均每秒上下文切换次数
+	IntrPerSecond       float64   //一个周期平均每秒中断次数
+	ForkPerSecond       float64   //一个周期平均每秒创建的进程数
+	Last                time.Time //上次采集时间, 第一次采集前为零值
+	IdleRateSum10       float64   //空闲时间百分比10分钟累加和
+	IdleRateSum10Times  int       //空闲时间百分比10分钟累加次数
+	IdleRate10          float64   //空闲时间10分钟环比
 	IdleRate10Last      int64
 	IdleRateSum60       float64 //空闲时间百分比60分钟累加和
 	IdleRateSum60Times  int     //空闲时间百分比60分钟累加次数
@@ -46,10 +94,77 @@ type Cpu struct {
 	IdleRateSumDayTimes int     //空闲时间百分比24h累加次数
 	IdleRateDay         float64 //空闲时间日同比
 	IdleRateDayLast     int64
+	CoreMap             map[int]*CpuCore //每个核, key为核编号
+	CoreIndexes         []int            //在线的核编号, 与/proc/stat中顺序一致
+	ProcRoot            string           //procfs根目录, 为空时使用ProcRoot
+	Now                 func() time.Time //取当前时间, 为空时使用time.Now
+}
+
+//单个核的cpu时间(jiffies)及一个周期内各状态时间百分比
+type CpuCore struct {
+	Index     int //核编号, 即cpuN中的N
+	User      uint64
+	Nice      uint64
+	System    uint64
+	Idle      uint64
+	Iowait    uint64
+	Irq       uint64
+	SoftIrq   uint64
+	Steal     uint64 //虚拟机中被宿主机其他虚拟机占用的时间
+	Guest     uint64 //运行虚拟机的时间, 已包含在User中
+	GuestNice uint64 //运行nice值为负的虚拟机的时间, 已包含在Nice中
+	Total     uint64 //user + nice + system + idle + iowait + irq + softirq + steal
+
+	UserRate    float64
+	NiceRate    float64
+	SystemRate  float64
+	IdleRate    float64
+	IoWaitRate  float64
+	IrqRate     float64
+	SoftIrqRate float64
+	StealRate   float64
+	GuestRate   float64
+	UsedRate    float64 //使用率, 即100 - IdleRate - IoWaitRate
+}
+
+//按/proc/stat中cpuN行user之后的各列更新, 老内核没有的列按0处理
+func (this *CpuCore) update(strList []string) {
+	values := make([]uint64, 10)
+	for i := 0; i < len(strList) && i < len(values); i++ {
+		values[i], _ = strconv.ParseUint(strList[i], 10, 64)
+	}
+	total := values[0] + values[1] + values[2] + values[3] + values[4] + values[5] + values[6] + values[7]
+	diffTotal := float64(CounterDiff(total, this.Total))
+	if this.Total > 0 && diffTotal > 0 {
+		rate := func(cur uint64, last uint64) float64 {
+			return float64(CounterDiff(cur, last)) / diffTotal * 100
+		}
+		this.UserRate = rate(values[0], this.User)
+		this.NiceRate = rate(values[1], this.Nice)
+		this.SystemRate = rate(values[2], this.System)
+		this.IdleRate = rate(values[3], this.Idle)
+		this.IoWaitRate = rate(values[4], this.Iowait)
+		this.IrqRate = rate(values[5], this.Irq)
+		this.SoftIrqRate = rate(values[6], this.SoftIrq)
+		this.StealRate = rate(values[7], this.Steal)
+		this.GuestRate = rate(values[8]+values[9], this.Guest+this.GuestNice)
+		this.UsedRate = 100 - this.IdleRate - this.IoWaitRate
+	}
+	this.User = values[0]
+	this.Nice = values[1]
+	this.System = values[2]
+	this.Idle = values[3]
+	this.Iowait = values[4]
+	this.Irq = values[5]
+	this.SoftIrq = values[6]
+	this.Steal = values[7]
+	this.Guest = values[8]
+	this.GuestNice = values[9]
+	this.Total = total
 }
 
 func (this *Cpu) Dump() {
-	fmt.Printf("User:%d, Nice:%d, System:%d, Idle:%d, Iowait:%d, Irq:%d, SoftIrq:%d, Total:%d, IoWaitRate:%f\n",
+	fmt.Printf("User:%d, Nice:%d, System:%d, Idle:%d, Iowait:%d, Irq:%d, SoftIrq:%d, Steal:%d, Guest:%d, Total:%d, IoWaitRate:%f, StealRate:%f, CtxtPerSecond:%f, IntrPerSecond:%f, ForkPerSecond:%f\n",
 		this.User,
 		this.Nice,
 		this.System,
@@ -57,18 +172,41 @@ func (this *Cpu) Dump() {
 		this.Iowait,
 		this.Irq,
 		this.SoftIrq,
+		this.Steal,
+		this.Guest,
 		this.Total,
-		this.IoWaitRate)
+		this.IoWaitRate,
+		this.StealRate,
+		this.CtxtPerSecond,
+		this.IntrPerSecond,
+		this.ForkPerSecond)
+	for _, index := range this.CoreIndexes {
+		core := this.CoreMap[index]
+		fmt.Printf("cpu%d UserRate:%f, SystemRate:%f, IoWaitRate:%f, IrqRate:%f, SoftIrqRate:%f, StealRate:%f, UsedRate:%f\n",
+			core.Index,
+			core.UserRate,
+			core.SystemRate,
+			core.IoWaitRate,
+			core.IrqRate,
+			core.SoftIrqRate,
+			core.StealRate,
+			core.UsedRate)
+	}
 }
 
 func (this *Cpu) Collect() error {
-	f, err := os.Open("/proc/stat")
+	f, err := os.Open(ProcPath(this.ProcRoot, "stat"))
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	if this.CoreMap == nil {
+		this.CoreMap = map[int]*CpuCore{}
+	}
+	coreIndexes := []int{}
+	now := currentTime(this.Now)
+	difftime := now.Sub(this.Last).Seconds()
 	reader := bufio.NewReader(f)
-	readCpuTag := false
 	for {
 		line, err := reader.ReadString('\n')
 		if err == io.EOF {
@@ -77,39 +215,48 @@ func (this *Cpu) Collect() error {
 		if err != nil {
 			return err
 		}
-		if strings.Contains(line, "cpu") {
-			if readCpuTag {
-				//读取过，跳过
-				continue
+		strList := strings.Fields(line)
+		if len(strList) == 0 {
+			continue
+		}
+		if strList[0] == "cpu" {
+			//文件中顺序依次为user, nice, system, idle, iowait, irq, softirq, steal, guest, guest_nice, 老内核没有的列为0
+			values := make([]uint64, 10)
+			for i := 1; i < len(strList) && i <= len(values); i++ {
+				values[i-1], _ = strconv.ParseUint(strList[i], 10, 64)
 			}
-			//文件中顺序依次为user, nice, system, idle, iowait, irq, softirq, stealstolen, guest
-			strList := strings.Fields(line)
-			user, _ := strconv.ParseUint(strList[1], 10, 64)
-			nice, _ := strconv.ParseUint(strList[2], 10, 64)
-			system, _ := strconv.ParseUint(strList[3], 10, 64)
-			idle, _ := strconv.ParseUint(strList[4], 10, 64)
-			iowait, _ := strconv.ParseUint(strList[5], 10, 64)
-			irq, _ := strconv.ParseUint(strList[6], 10, 64)
-			softIrq, _ := strconv.ParseUint(strList[7], 10, 64)
-			total := user + nice + system + idle + iowait
-
-			diffTotal := float64(total - this.Total)
+			user, nice, system, idle, iowait := values[0], values[1], values[2], values[3], values[4]
+			irq, softIrq, steal, guest, guestNice := values[5], values[6], values[7], values[8], values[9]
+			//guest、guest_nice已计入user、nice, 不重复累加
+			total := user + nice + system + idle + iowait + irq + softIrq + steal
+
+			diffTotal := float64(CounterDiff(total, this.Total))
 
 			if this.Total <= 0 {
 				//第一次采集，没产生时间差，不计算
 			} else {
 				if diffTotal > 0 {
 					//io等待时间百分比
-					diffIo := iowait - this.Iowait
+					diffIo := CounterDiff(iowait, this.Iowait)
 					this.IoWaitRate = float64(diffIo) / diffTotal * 100
 					//内核态时间百分比
-					diffSystem := system - this.System
+					diffSystem := CounterDiff(system, this.System)
 					this.SystemRate = float64(diffSystem) / diffTotal * 100
 					//用户态时间百分比
-					diffUser := user - this.User
+					diffUser := CounterDiff(user, this.User)
 					this.UserRate = float64(diffUser) / diffTotal * 100
 					//空闲时间百分比
-					this.IdleRate = float64(idle-this.Idle) / diffTotal * 100
+					this.IdleRate = float64(CounterDiff(idle, this.Idle)) / diffTotal * 100
+					//nice值为负的进程时间百分比
+					this.NiceRate = float64(CounterDiff(nice, this.Nice)) / diffTotal * 100
+					//硬中断时间百分比
+					this.IrqRate = float64(CounterDiff(irq, this.Irq)) / diffTotal * 100
+					//软中断时间百分比
+					this.SoftIrqRate = float64(CounterDiff(softIrq, this.SoftIrq)) / diffTotal * 100
+					//被宿主机占用时间百分比
+					this.StealRate = float64(CounterDiff(steal, this.Steal)) / diffTotal * 100
+					//运行虚拟机时间百分比
+					this.GuestRate = float64(CounterDiff(guest+guestNice, this.Guest+this.GuestNice)) / diffTotal * 100
 				}
 			}
 
@@ -120,19 +267,64 @@ func (this *Cpu) Collect() error {
 			this.Iowait = iowait
 			this.Irq = irq
 			this.SoftIrq = softIrq
+			this.Steal = steal
+			this.Guest = guest
+			this.GuestNice = guestNice
 			this.Total = total
-			readCpuTag = true
 
-		} else if strings.Contains(line, "procs_blocked") {
-			strList := strings.Fields(line)
+		} else if strings.HasPrefix(strList[0], "cpu") {
+			//cpu0, cpu1..., 离线的核不出现
+			index, err := strconv.Atoi(strList[0][3:])
+			if err != nil {
+				continue
+			}
+			core, exists := this.CoreMap[index]
+			if !exists {
+				core = &CpuCore{Index: index}
+				this.CoreMap[index] = core
+			}
+			core.update(strList[1:])
+			coreIndexes = append(coreIndexes, index)
+		} else if strList[0] == "ctxt" || strList[0] == "intr" || strList[0] == "processes" {
+			//intr第一列为总数, 之后为每个中断号的次数
+			value, _ := strconv.ParseUint(strList[1], 10, 64)
+			var last *uint64
+			var perSecond *float64
+			switch strList[0] {
+			case "ctxt":
+				last, perSecond = &this.Ctxt, &this.CtxtPerSecond
+			case "intr":
+				last, perSecond = &this.Intr, &this.IntrPerSecond
+			default:
+				last, perSecond = &this.Processes, &this.ForkPerSecond
+			}
+			*perSecond = 0
+			if !this.Last.IsZero() && difftime > 0 {
+				*perSecond = float64(CounterDiff(value, *last)) / difftime
+			}
+			*last = value
+		} else if strList[0] == "btime" {
+			this.Btime, _ = strconv.ParseUint(strList[1], 10, 64)
+		} else if strList[0] == "procs_blocked" {
 			this.ProcsBlocked, _ = strconv.ParseUint(strList[1], 10, 64)
-		} else if strings.Contains(line, "procs_running") {
-			strList := strings.Fields(line)
+		} else if strList[0] == "procs_running" {
 			this.ProcsRunning, _ = strconv.ParseUint(strList[1], 10, 64)
 		} else {
 			continue
 		}
 	}
+	//去掉已离线的核, 重新上线后按第一次采集处理
+	online := map[int]bool{}
+	for _, index := range coreIndexes {
+		online[index] = true
+	}
+	for index := range this.CoreMap {
+		if !online[index] {
+			delete(this.CoreMap, index)
+		}
+	}
+	this.CoreIndexes = coreIndexes
+	this.Last = now
 	return nil
 }
 
@@ -157,6 +349,31 @@ func (this *Cpu) IdleRateFunc(args string) string {
 	return FloatToString(this.IdleRate)
 }
 
+//nice值为负的进程时间百分比
+func (this *Cpu) NiceRateFunc(args string) string {
+	return FloatToString(this.NiceRate)
+}
+
+//硬中断时间百分比
+func (this *Cpu) IrqRateFunc(args string) string {
+	return FloatToString(this.IrqRate)
+}
+
+//软中断时间百分比
+func (this *Cpu) SoftIrqRateFunc(args string) string {
+	return FloatToString(this.SoftIrqRate)
+}
+
+//被宿主机占用时间百分比
+func (this *Cpu) StealRateFunc(args string) string {
+	return FloatToString(this.StealRate)
+}
+
+//运行虚拟机时间百分比
+func (this *Cpu) GuestRateFunc(args string) string {
+	return FloatToString(this.GuestRate)
+}
+
 //阻塞进程数
 func (this *Cpu) ProcsBlockedFunc(args string) string {
 	return strconv.FormatUint(this.ProcsBlocked, 10)
@@ -167,6 +384,223 @@ func (this *Cpu) ProcsRunningFunc(args string) string {
 	return strconv.FormatUint(this.ProcsRunning, 10)
 }
 
+//平均每秒上下文切换次数
+func (this *Cpu) CtxtPerSecondFunc(args string) string {
+	return FloatToString(this.CtxtPerSecond)
+}
+
+//平均每秒中断次数
+func (this *Cpu) IntrPerSecondFunc(args string) string {
+	return FloatToString(this.IntrPerSecond)
+}
+
+//平均每秒创建的进程数
+func (this *Cpu) ForkPerSecondFunc(args string) string {
+	return FloatToString(this.ForkPerSecond)
+}
+
+//从系统启动开始累计的上下文切换次数
+func (this *Cpu) CtxtFunc(args string) string {
+	return strconv.FormatUint(this.Ctxt, 10)
+}
+
+//从系统启动开始累计的中断次数
+func (this *Cpu) IntrFunc(args string) string {
+	return strconv.FormatUint(this.Intr, 10)
+}
+
+//从系统启动开始累计创建的进程数
+func (this *Cpu) ProcessesFunc(args string) string {
+	return strconv.FormatUint(this.Processes, 10)
+}
+
+//开机时间(unix时间戳)
+func (this *Cpu) BtimeFunc(args string) string {
+	return strconv.FormatUint(this.Btime, 10)
+}
+
+//从系统启动开始累计的用户态时间(jiffies)
+func (this *Cpu) UserFunc(args string) string {
+	return strconv.FormatUint(this.User, 10)
+}
+
+//从系统启动开始累计的nice值为负的进程时间(jiffies)
+func (this *Cpu) NiceFunc(args string) string {
+	return strconv.FormatUint(this.Nice, 10)
+}
+
+//从系统启动开始累计的内核态时间(jiffies)
+func (this *Cpu) SystemFunc(args string) string {
+	return strconv.FormatUint(this.System, 10)
+}
+
+//从系统启动开始累计的空闲时间(jiffies)
+func (this *Cpu) IdleFunc(args string) string {
+	return strconv.FormatUint(this.Idle, 10)
+}
+
+//从系统启动开始累计的硬盘IO等待时间(jiffies)
+func (this *Cpu) IowaitFunc(args string) string {
+	return strconv.FormatUint(this.Iowait, 10)
+}
+
+//从系统启动开始累计的硬中断时间(jiffies)
+func (this *Cpu) IrqFunc(args string) string {
+	return strconv.FormatUint(this.Irq, 10)
+}
+
+//从系统启动开始累计的软中断时间(jiffies)
+func (this *Cpu) SoftIrqFunc(args string) string {
+	return strconv.FormatUint(this.SoftIrq, 10)
+}
+
+//从系统启动开始累计的被宿主机占用时间(jiffies)
+func (this *Cpu) StealFunc(args string) string {
+	return strconv.FormatUint(this.Steal, 10)
+}
+
+//从系统启动开始累计的运行虚拟机时间(jiffies), 含guest_nice
+func (this *Cpu) GuestFunc(args string) string {
+	return strconv.FormatUint(this.Guest+this.GuestNice, 10)
+}
+
+//按核编号取核, 也可传cpu3这样的名称
+func (this *Cpu) GetCoreByIndex(args string) (*CpuCore, error) {
+	index, err := strconv.Atoi(strings.TrimPrefix(args, "cpu"))
+	if err != nil {
+		return nil, err
+	}
+	core, exists := this.CoreMap[index]
+	if !exists {
+		return nil, errors.New("core not found")
+	}
+	return core, nil
+}
+
+//在线的核编号
+func (this *Cpu) Cores() []string {
+	cores := []string{}
+	for _, index := range this.CoreIndexes {
+		cores = append(cores, strconv.Itoa(index))
+	}
+	return cores
+}
+
+//使用率最高的核, 没有核时返回nil
+func (this *Cpu) HottestCore() *CpuCore {
+	var hottest *CpuCore
+	for _, index := range this.CoreIndexes {
+		core := this.CoreMap[index]
+		if hottest == nil || core.UsedRate > hottest.UsedRate {
+			hottest = core
+		}
+	}
+	return hottest
+}
+
+//使用率超过rate(%)的核
+func (this *Cpu) CoresAbove(rate float64) []*CpuCore {
+	cores := []*CpuCore{}
+	for _, index := range this.CoreIndexes {
+		core := this.CoreMap[index]
+		if core.UsedRate > rate {
+			cores = append(cores, core)
+		}
+	}
+	return cores
+}
+
+func (this *Cpu) coreRateFunc(rate func(core *CpuCore) float64) MetricFunc {
+	return func(args string) string {
+		core, err := this.GetCoreByIndex(args)
+		if err != nil {
+			return ""
+		}
+		return FloatToString(rate(core))
+	}
+}
+
+//使用率最高的核的使用率
+func (this *Cpu) HottestCoreRateFunc(args string) string {
+	core := this.HottestCore()
+	if core == nil {
+		return ""
+	}
+	return FloatToString(core.UsedRate)
+}
+
+//使用率最高的核的编号
+func (this *Cpu) HottestCoreFunc(args string) string {
+	core := this.HottestCore()
+	if core == nil {
+		return ""
+	}
+	return strconv.Itoa(core.Index)
+}
+
+//cpu.core.above.num默认上报的阈值(%), 其他阈值可通过Registry.Get取
+var CoreAboveRates = []string{"80", "90"}
+
+//cpu.core.above.num上报的阈值
+func (this *Cpu) AboveRates() []string {
+	return append([]string{}, CoreAboveRates...)
+}
+
+//使用率超过args(%)的核数
+func (this *Cpu) CoresAboveFunc(args string) string {
+	rate, err := strconv.ParseFloat(args, 64)
+	if err != nil {
+		return ""
+	}
+	return strconv.Itoa(len(this.CoresAbove(rate)))
+}
+
+func (this *Cpu) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "cpu.user.jiffies", Unit: "jiffies", Type: COUNTER, Desc: "用户态时间", Func: this.UserFunc},
+		{Key: "cpu.nice.jiffies", Unit: "jiffies", Type: COUNTER, Desc: "nice值为负的进程时间", Func: this.NiceFunc},
+		{Key: "cpu.system.jiffies", Unit: "jiffies", Type: COUNTER, Desc: "内核态时间", Func: this.SystemFunc},
+		{Key: "cpu.idle.jiffies", Unit: "jiffies", Type: COUNTER, Desc: "空闲时间", Func: this.IdleFunc},
+		{Key: "cpu.iowait.jiffies", Unit: "jiffies", Type: COUNTER, Desc: "硬盘IO等待时间", Func: this.IowaitFunc},
+		{Key: "cpu.irq.jiffies", Unit: "jiffies", Type: COUNTER, Desc: "硬中断时间", Func: this.IrqFunc},
+		{Key: "cpu.softirq.jiffies", Unit: "jiffies", Type: COUNTER, Desc: "软中断时间", Func: this.SoftIrqFunc},
+		{Key: "cpu.steal.jiffies", Unit: "jiffies", Type: COUNTER, Desc: "被宿主机占用时间", Func: this.StealFunc},
+		{Key: "cpu.guest.jiffies", Unit: "jiffies", Type: COUNTER, Desc: "运行虚拟机时间", Func: this.GuestFunc},
+		{Key: "cpu.iowait.rate", Unit: "%", Type: GAUGE, Desc: "io等待时间百分比", Func: this.IoWaitRateFunc},
+		{Key: "cpu.system.rate", Unit: "%", Type: GAUGE, Desc: "内核态时间百分比", Func: this.SystemRateFunc},
+		{Key: "cpu.user.rate", Unit: "%", Type: GAUGE, Desc: "用户态时间百分比", Func: this.UserRateFunc},
+		{Key: "cpu.idle.rate", Unit: "%", Type: GAUGE, Desc: "空闲时间百分比", Func: this.IdleRateFunc},
+		{Key: "cpu.nice.rate", Unit: "%", Type: GAUGE, Desc: "nice值为负的进程时间百分比", Func: this.NiceRateFunc},
+		{Key: "cpu.irq.rate", Unit: "%", Type: GAUGE, Desc: "硬中断时间百分比", Func: this.IrqRateFunc},
+		{Key: "cpu.softirq.rate", Unit: "%", Type: GAUGE, Desc: "软中断时间百分比", Func: this.SoftIrqRateFunc},
+		{Key: "cpu.steal.rate", Unit: "%", Type: GAUGE, Desc: "被宿主机占用时间百分比", Func: this.StealRateFunc},
+		{Key: "cpu.guest.rate", Unit: "%", Type: GAUGE, Desc: "运行虚拟机时间百分比", Func: this.GuestRateFunc},
+		{Key: "cpu.procs.blocked", Type: GAUGE, Desc: "阻塞进程数", Func: this.ProcsBlockedFunc},
+		{Key: "cpu.procs.running", Type: GAUGE, Desc: "运行进程数", Func: this.ProcsRunningFunc},
+		{Key: "cpu.ctxt.switches", Type: COUNTER, Desc: "上下文切换次数", Func: this.CtxtFunc},
+		{Key: "cpu.interrupts", Type: COUNTER, Desc: "中断次数", Func: this.IntrFunc},
+		{Key: "cpu.forks", Type: COUNTER, Desc: "创建的进程数", Func: this.ProcessesFunc},
+		{Key: "cpu.ctxt.switches.avg", Unit: "1/s", Type: GAUGE, Desc: "每秒上下文切换次数", Func: this.CtxtPerSecondFunc},
+		{Key: "cpu.interrupts.avg", Unit: "1/s", Type: GAUGE, Desc: "每秒中断次数", Func: this.IntrPerSecondFunc},
+		{Key: "cpu.forks.avg", Unit: "1/s", Type: GAUGE, Desc: "每秒创建的进程数", Func: this.ForkPerSecondFunc},
+		{Key: "cpu.boot.time", Unit: "s", Type: GAUGE, Desc: "开机时间(unix时间戳)", Func: this.BtimeFunc},
+
+		{Key: "cpu.core.user.rate", Unit: "%", Type: GAUGE, Desc: "单核用户态时间百分比", Label: "cpu", Args: this.Cores, Func: this.coreRateFunc(func(core *CpuCore) float64 { return core.UserRate })},
+		{Key: "cpu.core.nice.rate", Unit: "%", Type: GAUGE, Desc: "单核nice值为负的进程时间百分比", Label: "cpu", Args: this.Cores, Func: this.coreRateFunc(func(core *CpuCore) float64 { return core.NiceRate })},
+		{Key: "cpu.core.system.rate", Unit: "%", Type: GAUGE, Desc: "单核内核态时间百分比", Label: "cpu", Args: this.Cores, Func: this.coreRateFunc(func(core *CpuCore) float64 { return core.SystemRate })},
+		{Key: "cpu.core.idle.rate", Unit: "%", Type: GAUGE, Desc: "单核空闲时间百分比", Label: "cpu", Args: this.Cores, Func: this.coreRateFunc(func(core *CpuCore) float64 { return core.IdleRate })},
+		{Key: "cpu.core.iowait.rate", Unit: "%", Type: GAUGE, Desc: "单核io等待时间百分比", Label: "cpu", Args: this.Cores, Func: this.coreRateFunc(func(core *CpuCore) float64 { return core.IoWaitRate })},
+		{Key: "cpu.core.irq.rate", Unit: "%", Type: GAUGE, Desc: "单核硬中断时间百分比", Label: "cpu", Args: this.Cores, Func: this.coreRateFunc(func(core *CpuCore) float64 { return core.IrqRate })},
+		{Key: "cpu.core.softirq.rate", Unit: "%", Type: GAUGE, Desc: "单核软中断时间百分比", Label: "cpu", Args: this.Cores, Func: this.coreRateFunc(func(core *CpuCore) float64 { return core.SoftIrqRate })},
+		{Key: "cpu.core.steal.rate", Unit: "%", Type: GAUGE, Desc: "单核被宿主机占用时间百分比", Label: "cpu", Args: this.Cores, Func: this.coreRateFunc(func(core *CpuCore) float64 { return core.StealRate })},
+		{Key: "cpu.core.guest.rate", Unit: "%", Type: GAUGE, Desc: "单核运行虚拟机时间百分比", Label: "cpu", Args: this.Cores, Func: this.coreRateFunc(func(core *CpuCore) float64 { return core.GuestRate })},
+		{Key: "cpu.core.used.rate", Unit: "%", Type: GAUGE, Desc: "单核使用率", Label: "cpu", Args: this.Cores, Func: this.coreRateFunc(func(core *CpuCore) float64 { return core.UsedRate })},
+		{Key: "cpu.core.max.used.rate", Unit: "%", Type: GAUGE, Desc: "使用率最高的核的使用率", Func: this.HottestCoreRateFunc},
+		{Key: "cpu.core.max.index", Type: GAUGE, Desc: "使用率最高的核的编号", Func: this.HottestCoreFunc},
+		{Key: "cpu.core.above.num", Type: GAUGE, Desc: "使用率超过某百分比的核数", Label: "rate", Args: this.AboveRates, Func: this.CoresAboveFunc},
+	}
+}
+
 /*
 //累加空闲时间百分比
 func (this *Cpu) AddIdleRate(idleRate float64) {
@@ -257,7 +691,28 @@ func (this *Cpu) IdleRateDayFunc(args string) string {
 }*/
 
 //返回某个进程的cpu使用率
+//与top的%CPU列一致, 按进程名匹配, 取间隔procCpuSampleInterval内的cpu时间
 func CpuUsedRateByProc(proc string) string {
-	//return ExecOutput("ps axuwww|grep " + proc + "|grep -v grep|awk 'BEGIN{sum=0}{sum+=$3 }END{print sum}'")
-	return ExecOutput("top -n 1 -b |grep '"+proc+"'|grep -v grep|awk 'BEGIN{sum=0}{sum+=$9 }END{print sum}'")
+	last, err := processesByComm(proc)
+	if err != nil {
+		return ""
+	}
+	time.Sleep(procCpuSampleInterval)
+	procs, err := processesByComm(proc)
+	if err != nil {
+		return ""
+	}
+	var sum float64
+	for pid, p := range procs {
+		l, exists := last[pid]
+		if !exists {
+			//采样期间新启动的进程
+			continue
+		}
+		ticks := CounterDiff(p.Utime+p.Stime, l.Utime+l.Stime)
+		rate := float64(ticks) * 100 / clockTicks / procCpuSampleInterval.Seconds()
+		//top保留1位小数
+		sum += math.Floor(rate*10+0.5) / 10
+	}
+	return AwkNumber(sum)
 }
@@ -0,0 +1,35 @@
+package system
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCpuCoreAboveNum(t *testing.T) {
+	c := &Cpu{ProcRoot: goldenProcRoot("kernel-6.8", "1")}
+	registry := NewRegistry()
+	if err := registry.Register("cpu", c); err != nil {
+		t.Fatal(err)
+	}
+	registry.Collect()
+	c.ProcRoot = goldenProcRoot("kernel-6.8", "2")
+	registry.Collect()
+
+	//每个核使用率均为40%
+	values := map[string]string{}
+	for _, sample := range registry.Samples() {
+		if sample.Metric.Key == "cpu.core.above.num" {
+			values[sample.Arg] = sample.Value
+		}
+	}
+	if len(values) != 2 || values["80"] != "0" || values["90"] != "0" {
+		t.Errorf("unexpected samples %v", values)
+	}
+	value, err := registry.Get("cpu.core.above.num", "30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != strconv.Itoa(len(c.CoreIndexes)) {
+		t.Errorf("got %s cores above 30%%, want %d", value, len(c.CoreIndexes))
+	}
+}
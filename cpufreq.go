@@ -0,0 +1,293 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//单个核的频率及降频次数
+type CoreFreq struct {
+	Index     int     //cpu编号
+	CurFreq   float64 //当前频率(MHz)
+	MinFreq   float64 //调频策略允许的最低频率(MHz)
+	MaxFreq   float64 //调频策略允许的最高频率(MHz)
+	HwMaxFreq float64 //硬件最高频率(MHz)
+	Governor  string  //调频策略, 如performance、powersave、schedutil
+	Driver    string  //调频驱动, 如intel_pstate、acpi-cpufreq、cppc_cpufreq
+
+	CoreThrottleCount    uint64 //从系统启动后累加的核过热降频次数
+	PackageThrottleCount uint64 //从系统启动后累加的物理cpu过热降频次数
+	CoreThrottleNew      uint64 //一个周期新增的核过热降频次数
+	PackageThrottleNew   uint64 //一个周期新增的物理cpu过热降频次数
+	throttleRead         bool   //是否已读过降频次数
+}
+
+//读/sys/devices/system/cpu/cpu*/cpufreq及thermal_throttle, 采集每个核的频率、调频策略及过热降频次数,
+//虚拟机等没有cpufreq时当前频率取/proc/cpuinfo的cpu MHz
+type CpuFreq struct {
+	CoreMap     map[int]*CoreFreq //cpu编号=>频率
+	CoreIndexes []int             //在线的cpu编号
+	ProcRoot    string            //procfs根目录, 为空时使用ProcRoot
+	SysRoot     string            //sysfs根目录, 为空时使用SysRoot
+}
+
+func (this *CpuFreq) Dump() {
+	for _, index := range this.CoreIndexes {
+		core := this.CoreMap[index]
+		fmt.Printf("cpu%d CurFreq:%f, MinFreq:%f, MaxFreq:%f, HwMaxFreq:%f, Governor:%s, CoreThrottleCount:%d, PackageThrottleCount:%d\n",
+			core.Index,
+			core.CurFreq,
+			core.MinFreq,
+			core.MaxFreq,
+			core.HwMaxFreq,
+			core.Governor,
+			core.CoreThrottleCount,
+			core.PackageThrottleCount)
+	}
+}
+
+func (this *CpuFreq) Collect() error {
+	if this.CoreMap == nil {
+		this.CoreMap = map[int]*CoreFreq{}
+	}
+	//cpuinfo中的cpu MHz, 没有cpufreq时使用
+	cpuMHz := map[int]float64{}
+	if content, err := GetFileContent(ProcPath(this.ProcRoot, "cpuinfo")); err == nil {
+		index := -1
+		for _, line := range strings.Split(content, "\n") {
+			pos := strings.Index(line, ":")
+			if pos < 0 {
+				continue
+			}
+			key := strings.TrimSpace(line[:pos])
+			value := strings.TrimSpace(line[pos+1:])
+			if key == "processor" {
+				index, _ = strconv.Atoi(value)
+			} else if key == "cpu MHz" && index >= 0 {
+				cpuMHz[index], _ = strconv.ParseFloat(value, 64)
+			}
+		}
+	}
+	indexes := []int{}
+	if online, err := GetFileContent(SysPath(this.SysRoot, "devices", "system", "cpu", "online")); err == nil {
+		indexes = ParseCpuList(online)
+	}
+	if len(indexes) == 0 {
+		for index := range cpuMHz {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+	}
+	if len(indexes) == 0 {
+		return errors.New("no cpu found")
+	}
+
+	online := map[int]bool{}
+	for _, index := range indexes {
+		online[index] = true
+		core, exists := this.CoreMap[index]
+		if !exists {
+			core = &CoreFreq{Index: index}
+			this.CoreMap[index] = core
+		}
+		cpuDir := "cpu" + strconv.Itoa(index)
+		//频率单位为kHz
+		freq := func(name string) float64 {
+			content, err := GetFileContent(SysPath(this.SysRoot, "devices", "system", "cpu", cpuDir, "cpufreq", name))
+			if err != nil {
+				return 0
+			}
+			value, _ := strconv.ParseFloat(strings.TrimSpace(content), 64)
+			return value / 1000
+		}
+		core.CurFreq = freq("scaling_cur_freq")
+		if core.CurFreq == 0 {
+			core.CurFreq = cpuMHz[index]
+		}
+		core.MinFreq = freq("scaling_min_freq")
+		core.MaxFreq = freq("scaling_max_freq")
+		core.HwMaxFreq = freq("cpuinfo_max_freq")
+		governor, _ := GetFileContent(SysPath(this.SysRoot, "devices", "system", "cpu", cpuDir, "cpufreq", "scaling_governor"))
+		core.Governor = strings.TrimSpace(governor)
+		driver, _ := GetFileContent(SysPath(this.SysRoot, "devices", "system", "cpu", cpuDir, "cpufreq", "scaling_driver"))
+		core.Driver = strings.TrimSpace(driver)
+
+		//thermal_throttle只有x86有
+		coreCount, coreErr := GetFileContent(SysPath(this.SysRoot, "devices", "system", "cpu", cpuDir, "thermal_throttle", "core_throttle_count"))
+		packageCount, packageErr := GetFileContent(SysPath(this.SysRoot, "devices", "system", "cpu", cpuDir, "thermal_throttle", "package_throttle_count"))
+		if coreErr != nil && packageErr != nil {
+			continue
+		}
+		coreThrottle, _ := strconv.ParseUint(strings.TrimSpace(coreCount), 10, 64)
+		packageThrottle, _ := strconv.ParseUint(strings.TrimSpace(packageCount), 10, 64)
+		core.CoreThrottleNew = 0
+		core.PackageThrottleNew = 0
+		if core.throttleRead {
+			core.CoreThrottleNew = CounterDiff(coreThrottle, core.CoreThrottleCount)
+			core.PackageThrottleNew = CounterDiff(packageThrottle, core.PackageThrottleCount)
+		}
+		core.CoreThrottleCount = coreThrottle
+		core.PackageThrottleCount = packageThrottle
+		core.throttleRead = true
+	}
+	for index := range this.CoreMap {
+		if !online[index] {
+			delete(this.CoreMap, index)
+		}
+	}
+	this.CoreIndexes = indexes
+	return nil
+}
+
+//按cpu编号取频率, 也可传cpu3这样的名称
+func (this *CpuFreq) GetCoreByIndex(args string) (*CoreFreq, error) {
+	index, err := strconv.Atoi(strings.TrimPrefix(args, "cpu"))
+	if err != nil {
+		return nil, err
+	}
+	core, exists := this.CoreMap[index]
+	if !exists {
+		return nil, errors.New("core not found")
+	}
+	return core, nil
+}
+
+//在线的cpu编号
+func (this *CpuFreq) Cores() []string {
+	cores := []string{}
+	for _, index := range this.CoreIndexes {
+		cores = append(cores, strconv.Itoa(index))
+	}
+	return cores
+}
+
+//一个周期发生过热降频的核
+func (this *CpuFreq) ThrottledCores() []*CoreFreq {
+	cores := []*CoreFreq{}
+	for _, index := range this.CoreIndexes {
+		core := this.CoreMap[index]
+		if core.CoreThrottleNew > 0 || core.PackageThrottleNew > 0 {
+			cores = append(cores, core)
+		}
+	}
+	return cores
+}
+
+//当前频率(MHz)
+func (this *CpuFreq) CurFreqFunc(args string) string {
+	core, err := this.GetCoreByIndex(args)
+	if err != nil || core.CurFreq == 0 {
+		return ""
+	}
+	return FloatToString(core.CurFreq)
+}
+
+//调频策略允许的最低频率(MHz)
+func (this *CpuFreq) MinFreqFunc(args string) string {
+	core, err := this.GetCoreByIndex(args)
+	if err != nil || core.MinFreq == 0 {
+		return ""
+	}
+	return FloatToString(core.MinFreq)
+}
+
+//调频策略允许的最高频率(MHz)
+func (this *CpuFreq) MaxFreqFunc(args string) string {
+	core, err := this.GetCoreByIndex(args)
+	if err != nil || core.MaxFreq == 0 {
+		return ""
+	}
+	return FloatToString(core.MaxFreq)
+}
+
+//调频策略
+func (this *CpuFreq) GovernorFunc(args string) string {
+	core, err := this.GetCoreByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return core.Governor
+}
+
+//从系统启动后累加的核过热降频次数
+func (this *CpuFreq) CoreThrottleFunc(args string) string {
+	core, err := this.GetCoreByIndex(args)
+	if err != nil || !core.throttleRead {
+		return ""
+	}
+	return strconv.FormatUint(core.CoreThrottleCount, 10)
+}
+
+//从系统启动后累加的物理cpu过热降频次数
+func (this *CpuFreq) PackageThrottleFunc(args string) string {
+	core, err := this.GetCoreByIndex(args)
+	if err != nil || !core.throttleRead {
+		return ""
+	}
+	return strconv.FormatUint(core.PackageThrottleCount, 10)
+}
+
+//一个周期新增的核过热降频次数
+func (this *CpuFreq) CoreThrottleNewFunc(args string) string {
+	core, err := this.GetCoreByIndex(args)
+	if err != nil || !core.throttleRead {
+		return ""
+	}
+	return strconv.FormatUint(core.CoreThrottleNew, 10)
+}
+
+//所有核平均当前频率(MHz)
+func (this *CpuFreq) CurFreqAvgFunc(args string) string {
+	var sum float64
+	num := 0
+	for _, index := range this.CoreIndexes {
+		core := this.CoreMap[index]
+		if core.CurFreq > 0 {
+			sum += core.CurFreq
+			num++
+		}
+	}
+	if num == 0 {
+		return ""
+	}
+	return FloatToString(sum / float64(num))
+}
+
+//所有核当前频率之和占硬件最高频率之和的百分比, 过热降频或节能策略时降低
+func (this *CpuFreq) FreqRateFunc(args string) string {
+	var cur, max float64
+	for _, index := range this.CoreIndexes {
+		core := this.CoreMap[index]
+		if core.CurFreq > 0 && core.HwMaxFreq > 0 {
+			cur += core.CurFreq
+			max += core.HwMaxFreq
+		}
+	}
+	if max == 0 {
+		return ""
+	}
+	return FloatToString(cur / max * 100)
+}
+
+//一个周期发生过热降频的核数
+func (this *CpuFreq) ThrottledNumFunc(args string) string {
+	return strconv.Itoa(len(this.ThrottledCores()))
+}
+
+func (this *CpuFreq) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "cpufreq.cur", Unit: "MHz", Type: GAUGE, Desc: "当前频率", Label: "cpu", Args: this.Cores, Func: this.CurFreqFunc},
+		{Key: "cpufreq.min", Unit: "MHz", Type: GAUGE, Desc: "调频策略允许的最低频率", Label: "cpu", Args: this.Cores, Func: this.MinFreqFunc},
+		{Key: "cpufreq.max", Unit: "MHz", Type: GAUGE, Desc: "调频策略允许的最高频率", Label: "cpu", Args: this.Cores, Func: this.MaxFreqFunc},
+		{Key: "cpufreq.governor", Type: TEXT, Desc: "调频策略", Label: "cpu", Args: this.Cores, Func: this.GovernorFunc},
+		{Key: "cpufreq.core.throttle", Type: COUNTER, Desc: "核过热降频次数", Label: "cpu", Args: this.Cores, Func: this.CoreThrottleFunc},
+		{Key: "cpufreq.package.throttle", Type: COUNTER, Desc: "物理cpu过热降频次数", Label: "cpu", Args: this.Cores, Func: this.PackageThrottleFunc},
+		{Key: "cpufreq.core.throttle.new", Type: GAUGE, Desc: "一个周期新增的核过热降频次数", Label: "cpu", Args: this.Cores, Func: this.CoreThrottleNewFunc},
+		{Key: "cpufreq.cur.avg", Unit: "MHz", Type: GAUGE, Desc: "所有核平均当前频率", Func: this.CurFreqAvgFunc},
+		{Key: "cpufreq.rate", Unit: "%", Type: GAUGE, Desc: "当前频率占硬件最高频率的百分比", Func: this.FreqRateFunc},
+		{Key: "cpufreq.throttled.num", Type: GAUGE, Desc: "一个周期发生过热降频的核数", Func: this.ThrottledNumFunc},
+	}
+}
@@ -0,0 +1,63 @@
+package system
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCpuFreq(t *testing.T) {
+	cases := []struct {
+		dir      string
+		driver   string
+		governor string
+		curFreq  map[string]string //cpu=>当前频率
+		curAvg   string
+		rate     string
+		throttle map[string]string //cpu=>核降频次数, 物理cpu降频次数
+	}{
+		{"cpuinfo-x86", "intel_pstate", "powersave",
+			map[string]string{"0": "2000.00", "3": "800.00", "7": "2000.00"}, "1850.00", "59.68",
+			map[string]string{"0": "0,0", "2": "0,3", "3": "1520,3", "6": "0,3"}},
+		//没有thermal_throttle时降频次数为空
+		{"cpuinfo-arm64", "cppc_cpufreq", "schedutil",
+			map[string]string{"0": "2600.00", "3": "2600.00"}, "2600.00", "86.67",
+			map[string]string{"0": ",", "3": ","}},
+	}
+	for _, c := range cases {
+		t.Run(c.dir, func(t *testing.T) {
+			freq := &CpuFreq{
+				ProcRoot: filepath.Join("testdata", c.dir, "proc"),
+				SysRoot:  filepath.Join("testdata", c.dir, "sys"),
+			}
+			if err := freq.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			for _, index := range freq.CoreIndexes {
+				core := freq.CoreMap[index]
+				if core.Driver != c.driver || core.Governor != c.governor {
+					t.Errorf("cpu%d Driver = %s, Governor = %s, want %s, %s", index, core.Driver, core.Governor, c.driver, c.governor)
+				}
+			}
+			for cpu, want := range c.curFreq {
+				if got := freq.CurFreqFunc(cpu); got != want {
+					t.Errorf("CurFreqFunc(%s) = %s, want %s", cpu, got, want)
+				}
+			}
+			if got := freq.CurFreqAvgFunc(""); got != c.curAvg {
+				t.Errorf("CurFreqAvgFunc = %s, want %s", got, c.curAvg)
+			}
+			if got := freq.FreqRateFunc(""); got != c.rate {
+				t.Errorf("FreqRateFunc = %s, want %s", got, c.rate)
+			}
+			for cpu, want := range c.throttle {
+				if got := freq.CoreThrottleFunc(cpu) + "," + freq.PackageThrottleFunc(cpu); got != want {
+					t.Errorf("throttle of cpu%s = %s, want %s", cpu, got, want)
+				}
+			}
+			//第一次采集不算新增降频
+			if got := freq.ThrottledNumFunc(""); got != "0" {
+				t.Errorf("ThrottledNumFunc = %s, want 0", got)
+			}
+		})
+	}
+}
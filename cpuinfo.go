@@ -0,0 +1,564 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//逻辑cpu的拓扑
+type LogicalCpu struct {
+	Index  int //cpu编号, 即cpuN中的N
+	Socket int //物理cpu编号(physical_package_id)
+	Core   int //物理核编号(core_id), 同一物理cpu内唯一
+	Node   int //NUMA节点编号, 未开启NUMA时为0
+}
+
+//cpu缓存, 同一级别同一类型的缓存按实例合并
+type CpuCache struct {
+	Level     int    //级别, 如1、2、3
+	Type      string //类型, Data、Instruction、Unified
+	Size      uint64 //单个实例大小(kb)
+	Instances int    //实例个数, 如每个物理核一个L1、每个物理cpu一个L3
+}
+
+//缓存名称, 与lscpu一致, 如L1d、L1i、L2、L3
+func (this *CpuCache) Name() string {
+	name := "L" + strconv.Itoa(this.Level)
+	switch this.Type {
+	case "Data":
+		name += "d"
+	case "Instruction":
+		name += "i"
+	}
+	return name
+}
+
+//CPU型号及拓扑, 读/proc/cpuinfo、/sys/devices/system/cpu、/sys/devices/system/node, 兼容x86及arm64
+type CpuInventory struct {
+	Vendor          string            //厂商, 如GenuineIntel、AuthenticAMD, arm64为CPU implementer对应的厂商, 如ARM、HiSilicon
+	Model           string            //型号, 即model name, arm64没有时为CPU part对应的型号, 如Neoverse-N1
+	Sockets         int               //物理cpu个数
+	Cores           int               //物理核数
+	Threads         int               //在线的逻辑cpu个数
+	ThreadsPerCore  int               //每个物理核的线程数, 开启超线程时为2
+	Cpus            []*LogicalCpu     //在线的逻辑cpu, 按编号排序
+	Nodes           map[int][]int     //NUMA节点编号=>cpu编号
+	NodeIndexes     []int             //NUMA节点编号
+	Caches          []*CpuCache       //按级别、类型排序
+	Flags           []string          //x86为flags, arm64为Features, 如avx2、avx512f、sve
+	Microcode       string            //微码版本, 如0xd0003a5
+	Vulnerabilities map[string]string //漏洞=>状态, 如spectre_v2=>Mitigation: Enhanced IBRS
+	ProcRoot        string            //procfs根目录, 为空时使用ProcRoot
+	SysRoot         string            //sysfs根目录, 为空时使用SysRoot
+}
+
+//arm64 CPU implementer对应的厂商
+var armImplementers = map[string]string{
+	"0x41": "ARM",
+	"0x42": "Broadcom",
+	"0x43": "Cavium",
+	"0x46": "Fujitsu",
+	"0x48": "HiSilicon",
+	"0x4e": "NVIDIA",
+	"0x50": "APM",
+	"0x51": "Qualcomm",
+	"0x61": "Apple",
+	"0xc0": "Ampere",
+}
+
+//arm64常见的CPU part对应的型号, 以implementer/part为key
+var armParts = map[string]string{
+	"0x41/0xd03": "Cortex-A53",
+	"0x41/0xd07": "Cortex-A57",
+	"0x41/0xd08": "Cortex-A72",
+	"0x41/0xd0b": "Cortex-A76",
+	"0x41/0xd0c": "Neoverse-N1",
+	"0x41/0xd40": "Neoverse-V1",
+	"0x41/0xd49": "Neoverse-N2",
+	"0x41/0xd4f": "Neoverse-V2",
+	"0x48/0xd01": "Kunpeng-920",
+	"0xc0/0xac3": "Ampere-1",
+	"0xc0/0xac4": "Ampere-1a",
+}
+
+func (this *CpuInventory) Dump() {
+	fmt.Printf("Vendor:%s, Model:%s, Sockets:%d, Cores:%d, Threads:%d, ThreadsPerCore:%d, Nodes:%d, Microcode:%s\n",
+		this.Vendor,
+		this.Model,
+		this.Sockets,
+		this.Cores,
+		this.Threads,
+		this.ThreadsPerCore,
+		len(this.NodeIndexes),
+		this.Microcode)
+	for _, cache := range this.Caches {
+		fmt.Printf("%s: %dK x %d\n", cache.Name(), cache.Size, cache.Instances)
+	}
+}
+
+func (this *CpuInventory) Collect() error {
+	content, err := GetFileContent(ProcPath(this.ProcRoot, "cpuinfo"))
+	if err != nil {
+		return err
+	}
+	//每个逻辑cpu一段, 以空行分隔
+	infos := map[int]map[string]string{}
+	header := map[string]string{}
+	for _, block := range strings.Split(content, "\n\n") {
+		info := map[string]string{}
+		for _, line := range strings.Split(block, "\n") {
+			pos := strings.Index(line, ":")
+			if pos < 0 {
+				continue
+			}
+			info[strings.TrimSpace(line[:pos])] = strings.TrimSpace(line[pos+1:])
+		}
+		index, err := strconv.Atoi(info["processor"])
+		if err != nil {
+			//老内核arm64开头有一段不属于任何cpu的信息, 如Hardware
+			for key, value := range info {
+				header[key] = value
+			}
+			continue
+		}
+		infos[index] = info
+	}
+	if len(infos) == 0 {
+		return errors.New("no processor found in cpuinfo")
+	}
+	first := infos[minKey(infos)]
+	get := func(key string) string {
+		if value, exists := first[key]; exists {
+			return value
+		}
+		return header[key]
+	}
+
+	//型号
+	this.Vendor = get("vendor_id")
+	this.Model = get("model name")
+	this.Microcode = get("microcode")
+	flags := get("flags")
+	if implementer := get("CPU implementer"); implementer != "" {
+		//arm64
+		this.Vendor = implementer
+		if name, exists := armImplementers[implementer]; exists {
+			this.Vendor = name
+		}
+		if this.Model == "" {
+			part := get("CPU part")
+			this.Model = part
+			if name, exists := armParts[implementer+"/"+part]; exists {
+				this.Model = name
+			}
+		}
+		flags = get("Features")
+	}
+	this.Flags = strings.Fields(flags)
+	if this.Microcode == "" {
+		version, err := GetFileContent(SysPath(this.SysRoot, "devices", "system", "cpu", "cpu"+strconv.Itoa(minKey(infos)), "microcode", "version"))
+		if err == nil {
+			this.Microcode = strings.TrimSpace(version)
+		}
+	}
+
+	//在线的cpu, 没有sysfs时以cpuinfo为准
+	indexes := []int{}
+	if online, err := GetFileContent(SysPath(this.SysRoot, "devices", "system", "cpu", "online")); err == nil {
+		indexes = ParseCpuList(online)
+	}
+	if len(indexes) == 0 {
+		for index := range infos {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+	}
+
+	//NUMA节点
+	this.Nodes = map[int][]int{}
+	nodeOfCpu := map[int]int{}
+	nodeDirs, _ := ioutil.ReadDir(SysPath(this.SysRoot, "devices", "system", "node"))
+	for _, dir := range nodeDirs {
+		node, err := strconv.Atoi(strings.TrimPrefix(dir.Name(), "node"))
+		if err != nil || !strings.HasPrefix(dir.Name(), "node") {
+			continue
+		}
+		cpuList, err := GetFileContent(SysPath(this.SysRoot, "devices", "system", "node", dir.Name(), "cpulist"))
+		if err != nil {
+			continue
+		}
+		for _, index := range ParseCpuList(cpuList) {
+			nodeOfCpu[index] = node
+		}
+		this.Nodes[node] = []int{}
+	}
+
+	//拓扑
+	this.Cpus = []*LogicalCpu{}
+	sockets := map[int]bool{}
+	cores := map[string]bool{}
+	caches := map[string]*CpuCache{}
+	cacheInstances := map[string]bool{}
+	for _, index := range indexes {
+		cpuDir := "cpu" + strconv.Itoa(index)
+		cpu := &LogicalCpu{Index: index, Core: index}
+		if info, exists := infos[index]; exists {
+			if socket, err := strconv.Atoi(info["physical id"]); err == nil {
+				cpu.Socket = socket
+			}
+			if core, err := strconv.Atoi(info["core id"]); err == nil {
+				cpu.Core = core
+			}
+		}
+		if socket, err := readSysInt(SysPath(this.SysRoot, "devices", "system", "cpu", cpuDir, "topology", "physical_package_id")); err == nil {
+			//arm64老内核没有PPTT时为-1
+			if socket < 0 {
+				socket = 0
+			}
+			cpu.Socket = socket
+		}
+		if core, err := readSysInt(SysPath(this.SysRoot, "devices", "system", "cpu", cpuDir, "topology", "core_id")); err == nil {
+			cpu.Core = core
+		}
+		if node, exists := nodeOfCpu[index]; exists {
+			cpu.Node = node
+		} else {
+			//没有/sys/devices/system/node时从cpuN/nodeM链接取
+			dirs, _ := ioutil.ReadDir(SysPath(this.SysRoot, "devices", "system", "cpu", cpuDir))
+			for _, dir := range dirs {
+				if node, err := strconv.Atoi(strings.TrimPrefix(dir.Name(), "node")); err == nil && strings.HasPrefix(dir.Name(), "node") {
+					cpu.Node = node
+					break
+				}
+			}
+		}
+		this.Nodes[cpu.Node] = append(this.Nodes[cpu.Node], index)
+		sockets[cpu.Socket] = true
+		cores[strconv.Itoa(cpu.Socket)+"/"+strconv.Itoa(cpu.Core)] = true
+		this.Cpus = append(this.Cpus, cpu)
+
+		//缓存, 同一实例被多个cpu共享, 按shared_cpu_list去重
+		cacheDirs, _ := ioutil.ReadDir(SysPath(this.SysRoot, "devices", "system", "cpu", cpuDir, "cache"))
+		for _, dir := range cacheDirs {
+			if !strings.HasPrefix(dir.Name(), "index") {
+				continue
+			}
+			path := func(name string) string {
+				return SysPath(this.SysRoot, "devices", "system", "cpu", cpuDir, "cache", dir.Name(), name)
+			}
+			level, err := readSysInt(path("level"))
+			if err != nil {
+				continue
+			}
+			cacheType, _ := GetFileContent(path("type"))
+			cacheType = strings.TrimSpace(cacheType)
+			size, _ := GetFileContent(path("size"))
+			shared, _ := GetFileContent(path("shared_cpu_list"))
+			key := strconv.Itoa(level) + "/" + cacheType
+			cache, exists := caches[key]
+			if !exists {
+				cache = &CpuCache{Level: level, Type: cacheType, Size: parseCacheSize(size)}
+				caches[key] = cache
+			}
+			instance := key + "/" + strings.TrimSpace(shared)
+			if strings.TrimSpace(shared) == "" {
+				instance += "/" + cpuDir
+			}
+			if !cacheInstances[instance] {
+				cacheInstances[instance] = true
+				cache.Instances++
+			}
+		}
+	}
+	this.Threads = len(this.Cpus)
+	this.Sockets = len(sockets)
+	this.Cores = len(cores)
+	this.ThreadsPerCore = 0
+	if this.Cores > 0 {
+		this.ThreadsPerCore = this.Threads / this.Cores
+	}
+	this.NodeIndexes = []int{}
+	for node, cpus := range this.Nodes {
+		if len(cpus) == 0 {
+			//只有内存没有cpu的节点
+			continue
+		}
+		this.NodeIndexes = append(this.NodeIndexes, node)
+	}
+	sort.Ints(this.NodeIndexes)
+	this.Caches = []*CpuCache{}
+	for _, cache := range caches {
+		this.Caches = append(this.Caches, cache)
+	}
+	sort.Slice(this.Caches, func(i, j int) bool {
+		if this.Caches[i].Level != this.Caches[j].Level {
+			return this.Caches[i].Level < this.Caches[j].Level
+		}
+		return this.Caches[i].Type < this.Caches[j].Type
+	})
+
+	//漏洞及缓解措施
+	this.Vulnerabilities = map[string]string{}
+	vulnDir := SysPath(this.SysRoot, "devices", "system", "cpu", "vulnerabilities")
+	vulnFiles, _ := ioutil.ReadDir(vulnDir)
+	for _, file := range vulnFiles {
+		status, err := GetFileContent(SysPath(this.SysRoot, "devices", "system", "cpu", "vulnerabilities", file.Name()))
+		if err != nil {
+			continue
+		}
+		this.Vulnerabilities[file.Name()] = strings.TrimSpace(status)
+	}
+	return nil
+}
+
+//解析cpu列表, 如0-3,8-11
+func ParseCpuList(str string) []int {
+	cpus := []int{}
+	for _, part := range strings.Split(strings.TrimSpace(str), ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				continue
+			}
+		}
+		for i := start; i <= end; i++ {
+			cpus = append(cpus, i)
+		}
+	}
+	return cpus
+}
+
+//格式化cpu列表, 如[0 1 2 3 8]返回0-3,8
+func FormatCpuList(cpus []int) string {
+	sorted := append([]int{}, cpus...)
+	sort.Ints(sorted)
+	ret := []string{}
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if i == j {
+			ret = append(ret, strconv.Itoa(sorted[i]))
+		} else {
+			ret = append(ret, strconv.Itoa(sorted[i])+"-"+strconv.Itoa(sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ret, ",")
+}
+
+//缓存大小, 如32K、1024K、32M, 返回kb
+func parseCacheSize(str string) uint64 {
+	str = strings.TrimSpace(str)
+	unit := uint64(1)
+	if strings.HasSuffix(str, "K") {
+		str = strings.TrimSuffix(str, "K")
+	} else if strings.HasSuffix(str, "M") {
+		str = strings.TrimSuffix(str, "M")
+		unit = 1024
+	}
+	size, _ := strconv.ParseUint(str, 10, 64)
+	return size * unit
+}
+
+func readSysInt(path string) (int, error) {
+	content, err := GetFileContent(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(content))
+}
+
+func minKey(m map[int]map[string]string) int {
+	min := -1
+	for key := range m {
+		if min < 0 || key < min {
+			min = key
+		}
+	}
+	return min
+}
+
+//是否支持某个指令集, 如avx2、avx512f
+func (this *CpuInventory) HasFlag(flag string) bool {
+	for _, f := range this.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+//所有缓存名称
+func (this *CpuInventory) CacheNames() []string {
+	names := []string{}
+	for _, cache := range this.Caches {
+		names = append(names, cache.Name())
+	}
+	return names
+}
+
+//所有NUMA节点编号
+func (this *CpuInventory) NodeNames() []string {
+	names := []string{}
+	for _, node := range this.NodeIndexes {
+		names = append(names, strconv.Itoa(node))
+	}
+	return names
+}
+
+//所有漏洞名称
+func (this *CpuInventory) VulnerabilityNames() []string {
+	names := []string{}
+	for name := range this.Vulnerabilities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (this *CpuInventory) getCache(name string) *CpuCache {
+	for _, cache := range this.Caches {
+		if cache.Name() == name {
+			return cache
+		}
+	}
+	return nil
+}
+
+//物理cpu个数
+func (this *CpuInventory) SocketsFunc(args string) string {
+	return strconv.Itoa(this.Sockets)
+}
+
+//物理核数
+func (this *CpuInventory) CoresFunc(args string) string {
+	return strconv.Itoa(this.Cores)
+}
+
+//逻辑cpu个数
+func (this *CpuInventory) ThreadsFunc(args string) string {
+	return strconv.Itoa(this.Threads)
+}
+
+//每个物理核的线程数
+func (this *CpuInventory) ThreadsPerCoreFunc(args string) string {
+	return strconv.Itoa(this.ThreadsPerCore)
+}
+
+//NUMA节点个数
+func (this *CpuInventory) NodesFunc(args string) string {
+	return strconv.Itoa(len(this.NodeIndexes))
+}
+
+//NUMA节点上的cpu, 如0-15,32-47
+func (this *CpuInventory) NodeCpusFunc(args string) string {
+	node, err := strconv.Atoi(strings.TrimPrefix(args, "node"))
+	if err != nil {
+		return ""
+	}
+	cpus, exists := this.Nodes[node]
+	if !exists {
+		return ""
+	}
+	return FormatCpuList(cpus)
+}
+
+//厂商
+func (this *CpuInventory) VendorFunc(args string) string {
+	return this.Vendor
+}
+
+//型号
+func (this *CpuInventory) ModelFunc(args string) string {
+	return this.Model
+}
+
+//微码版本
+func (this *CpuInventory) MicrocodeFunc(args string) string {
+	return this.Microcode
+}
+
+//所有指令集, 以空格分隔
+func (this *CpuInventory) FlagsFunc(args string) string {
+	return strings.Join(this.Flags, " ")
+}
+
+//是否支持某个指令集, 1为支持
+func (this *CpuInventory) FlagFunc(args string) string {
+	if len(this.Flags) == 0 {
+		return ""
+	}
+	if this.HasFlag(args) {
+		return "1"
+	}
+	return "0"
+}
+
+//单个缓存实例大小(kb)
+func (this *CpuInventory) CacheSizeFunc(args string) string {
+	cache := this.getCache(args)
+	if cache == nil {
+		return ""
+	}
+	return strconv.FormatUint(cache.Size, 10)
+}
+
+//缓存实例个数
+func (this *CpuInventory) CacheInstancesFunc(args string) string {
+	cache := this.getCache(args)
+	if cache == nil {
+		return ""
+	}
+	return strconv.Itoa(cache.Instances)
+}
+
+//漏洞状态, 如Not affected、Mitigation: ...、Vulnerable
+func (this *CpuInventory) VulnerabilityFunc(args string) string {
+	return this.Vulnerabilities[args]
+}
+
+//存在漏洞且没有缓解措施的个数
+func (this *CpuInventory) VulnerableNumFunc(args string) string {
+	if this.Vulnerabilities == nil {
+		return ""
+	}
+	num := 0
+	for _, status := range this.Vulnerabilities {
+		if strings.HasPrefix(status, "Vulnerable") {
+			num++
+		}
+	}
+	return strconv.Itoa(num)
+}
+
+func (this *CpuInventory) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "cpuinfo.sockets", Type: GAUGE, Desc: "物理cpu个数", Func: this.SocketsFunc},
+		{Key: "cpuinfo.cores", Type: GAUGE, Desc: "物理核数", Func: this.CoresFunc},
+		{Key: "cpuinfo.threads", Type: GAUGE, Desc: "逻辑cpu个数", Func: this.ThreadsFunc},
+		{Key: "cpuinfo.threads.per.core", Type: GAUGE, Desc: "每个物理核的线程数", Func: this.ThreadsPerCoreFunc},
+		{Key: "cpuinfo.numa.nodes", Type: GAUGE, Desc: "NUMA节点个数", Func: this.NodesFunc},
+		{Key: "cpuinfo.numa.cpus", Type: TEXT, Desc: "NUMA节点上的cpu", Label: "node", Args: this.NodeNames, Func: this.NodeCpusFunc},
+		{Key: "cpuinfo.vendor", Type: TEXT, Desc: "cpu厂商", Func: this.VendorFunc},
+		{Key: "cpuinfo.model", Type: TEXT, Desc: "cpu型号", Func: this.ModelFunc},
+		{Key: "cpuinfo.microcode", Type: TEXT, Desc: "微码版本", Func: this.MicrocodeFunc},
+		{Key: "cpuinfo.flags", Type: TEXT, Desc: "cpu支持的指令集", Func: this.FlagsFunc},
+		{Key: "cpuinfo.flag", Type: GAUGE, Desc: "是否支持某个指令集", Label: "flag", Func: this.FlagFunc},
+		{Key: "cpuinfo.cache.size", Unit: "kb", Type: GAUGE, Desc: "单个缓存实例大小", Label: "cache", Args: this.CacheNames, Func: this.CacheSizeFunc},
+		{Key: "cpuinfo.cache.instances", Type: GAUGE, Desc: "缓存实例个数", Label: "cache", Args: this.CacheNames, Func: this.CacheInstancesFunc},
+		{Key: "cpuinfo.vulnerability", Type: TEXT, Desc: "cpu漏洞缓解状态", Label: "vulnerability", Args: this.VulnerabilityNames, Func: this.VulnerabilityFunc},
+		{Key: "cpuinfo.vulnerable.num", Type: GAUGE, Desc: "没有缓解措施的cpu漏洞个数", Func: this.VulnerableNumFunc},
+	}
+}
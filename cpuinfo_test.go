@@ -0,0 +1,75 @@
+package system
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCpuInventory(t *testing.T) {
+	cases := []struct {
+		dir            string
+		vendor         string
+		model          string
+		sockets        int
+		cores          int
+		threads        int
+		threadsPerCore int
+		nodeCpus       map[string]string //NUMA节点=>cpu
+		caches         map[string]string //缓存=>大小(kb) x 实例个数
+		flag           string
+		microcode      bool
+		vulnerable     string
+	}{
+		{"cpuinfo-x86", "GenuineIntel", "Intel(R) Xeon(R) Gold 6330 CPU @ 2.00GHz", 2, 4, 8, 2,
+			map[string]string{"0": "0-1,4-5", "1": "2-3,6-7"},
+			map[string]string{"L1d": "48 x 4", "L1i": "32 x 4", "L2": "1280 x 4", "L3": "43008 x 2"},
+			"avx512f", true, "1"},
+		//arm64没有model name及physical id, 型号由CPU part得出
+		{"cpuinfo-arm64", "ARM", "Neoverse-N1", 1, 4, 4, 1,
+			map[string]string{"0": "0-3"},
+			map[string]string{"L3": "32768 x 1"},
+			"", false, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.dir, func(t *testing.T) {
+			inventory := &CpuInventory{
+				ProcRoot: filepath.Join("testdata", c.dir, "proc"),
+				SysRoot:  filepath.Join("testdata", c.dir, "sys"),
+			}
+			if err := inventory.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			if inventory.Vendor != c.vendor || inventory.Model != c.model {
+				t.Errorf("Vendor = %s, Model = %s, want %s, %s", inventory.Vendor, inventory.Model, c.vendor, c.model)
+			}
+			if inventory.Sockets != c.sockets || inventory.Cores != c.cores || inventory.Threads != c.threads || inventory.ThreadsPerCore != c.threadsPerCore {
+				t.Errorf("Sockets = %d, Cores = %d, Threads = %d, ThreadsPerCore = %d, want %d, %d, %d, %d",
+					inventory.Sockets, inventory.Cores, inventory.Threads, inventory.ThreadsPerCore,
+					c.sockets, c.cores, c.threads, c.threadsPerCore)
+			}
+			if got := inventory.NodesFunc(""); got != strconv.Itoa(len(c.nodeCpus)) {
+				t.Errorf("NodesFunc = %s, want %d", got, len(c.nodeCpus))
+			}
+			for node, want := range c.nodeCpus {
+				if got := inventory.NodeCpusFunc(node); got != want {
+					t.Errorf("NodeCpusFunc(%s) = %s, want %s", node, got, want)
+				}
+			}
+			for name, want := range c.caches {
+				if got := inventory.CacheSizeFunc(name) + " x " + inventory.CacheInstancesFunc(name); got != want {
+					t.Errorf("cache %s = %s, want %s", name, got, want)
+				}
+			}
+			if c.flag != "" && inventory.FlagFunc(c.flag) != "1" {
+				t.Errorf("FlagFunc(%s) = %s, want 1", c.flag, inventory.FlagFunc(c.flag))
+			}
+			if (inventory.Microcode != "") != c.microcode {
+				t.Errorf("Microcode = %q", inventory.Microcode)
+			}
+			if c.vulnerable != "" && inventory.VulnerableNumFunc("") != c.vulnerable {
+				t.Errorf("VulnerableNumFunc = %s, want %s", inventory.VulnerableNumFunc(""), c.vulnerable)
+			}
+		})
+	}
+}
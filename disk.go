@@ -2,8 +2,13 @@ package system
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 type FileSystem struct {
@@ -62,49 +67,31 @@ var mountedSet = []string{
 }
 
 func (this *Disk) Collect() error {
-	//注意，这里一定要加P, 否则当Filesystem 太长时，无法显示为一行, 采集数据会不全
-	cmd := "df -lP"
-	output, err := Exec(cmd)
+	fsList, err := LocalFileSystems()
 	if err != nil {
 		return err
 	}
-	lines := strings.Split(output, "\n")
 	this.FsMap = map[string]FileSystem{}
 	this.UsedRateSet = []string{}
+	this.Total = 0
+	this.Used = 0
+	this.Free = 0
 	var (
 		maxUseRate   float64
 		maxUseRateFs string
 	)
-	for row, line := range lines {
-		if row == 0 {
-			continue
-		}
-		fileds := strings.Fields(line)
-		if len(fileds) != 6 {
-			continue
-		}
-		fsName := fileds[0]
-		total, _ := strconv.ParseUint(fileds[1], 10, 64)
-		used, _ := strconv.ParseUint(fileds[2], 10, 64)
-		free, _ := strconv.ParseUint(fileds[3], 10, 64)
-		strUsedRate := strings.Replace(fileds[4], "%", "", -1)
-		usedRate, _ := strconv.ParseFloat(strUsedRate, 64)
-		mount := fileds[5]
-		//挂载分区使用情况
-		fs := FileSystem{}
-		fs.FsName = fsName
-		fs.Total = total
-		fs.Used = used
-		fs.Free = free
-		fs.UsedRate = usedRate
-		fs.Mount = mount
-		this.FsMap[mount] = fs
+	for _, fs := range fsList {
+		this.FsMap[fs.Mount] = fs
 		//更新所有挂载分区使用情况
-		this.Total += total
-		this.Used += used
-		this.Free += free
+		this.Total += fs.Total
+		this.Used += fs.Used
+		this.Free += fs.Free
 		//磁盘所有分区使用率集合
-		this.UsedRateSet = append(this.UsedRateSet, fsName+"="+mount+"="+strUsedRate)
+		strUsedRate := "-"
+		if fs.Used+fs.Free > 0 {
+			strUsedRate = strconv.FormatFloat(fs.UsedRate, 'f', 0, 64)
+		}
+		this.UsedRateSet = append(this.UsedRateSet, fs.FsName+"="+fs.Mount+"="+strUsedRate)
 		if fs.FsName != "devfs" && fs.UsedRate > maxUseRate {
 			maxUseRate = fs.UsedRate
 			maxUseRateFs = fs.Mount
@@ -122,6 +109,130 @@ func (this *Disk) Collect() error {
 	return nil
 }
 
+//df -lP不显示的伪文件系统
+var dummyFsTypes = map[string]struct{}{
+	"autofs":      struct{}{},
+	"proc":        struct{}{},
+	"subfs":       struct{}{},
+	"debugfs":     struct{}{},
+	"devpts":      struct{}{},
+	"fusectl":     struct{}{},
+	"fuse.portal": struct{}{},
+	"mqueue":      struct{}{},
+	"rpc_pipefs":  struct{}{},
+	"sysfs":       struct{}{},
+	"devfs":       struct{}{},
+	"kernfs":      struct{}{},
+	"ignore":      struct{}{},
+	"binfmt_misc": struct{}{},
+	"cgroup":      struct{}{},
+	"cgroup2":     struct{}{},
+	"securityfs":  struct{}{},
+	"pstore":      struct{}{},
+	"bpf":         struct{}{},
+	"tracefs":     struct{}{},
+	"configfs":    struct{}{},
+	"hugetlbfs":   struct{}{},
+	"nsfs":        struct{}{},
+}
+
+//df -lP不显示的网络文件系统
+var remoteFsTypes = map[string]struct{}{
+	"nfs":        struct{}{},
+	"nfs4":       struct{}{},
+	"smbfs":      struct{}{},
+	"smb3":       struct{}{},
+	"cifs":       struct{}{},
+	"ncpfs":      struct{}{},
+	"acfs":       struct{}{},
+	"afs":        struct{}{},
+	"coda":       struct{}{},
+	"auristorfs": struct{}{},
+	"fhgfs":      struct{}{},
+	"gpfs":       struct{}{},
+	"ibrix":      struct{}{},
+	"ocfs2":      struct{}{},
+	"vxfs":       struct{}{},
+}
+
+//读/proc/mounts并statfs每个挂载点, 结果与df -lP一致: 不含伪文件系统和网络文件系统,
+//同一设备挂载多次时只保留挂载路径最短的, 空间单位为kb, 使用率向上取整
+func LocalFileSystems() ([]FileSystem, error) {
+	content, err := GetFileContent(ProcPath("", "mounts"))
+	if err != nil {
+		return nil, err
+	}
+	fsList := []FileSystem{}
+	devIndex := map[uint64]int{} //设备号=>fsList下标
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		fsName := unescapeMount(fields[0])
+		mount := unescapeMount(fields[1])
+		fsType := fields[2]
+		if _, exists := dummyFsTypes[fsType]; exists || fsName == "none" {
+			continue
+		}
+		if _, exists := remoteFsTypes[fsType]; exists || strings.Contains(fsName, ":") || strings.HasPrefix(fsName, "//") {
+			continue
+		}
+		var st syscall.Stat_t
+		if err := syscall.Stat(mount, &st); err != nil {
+			continue
+		}
+		var stfs syscall.Statfs_t
+		if err := syscall.Statfs(mount, &stfs); err != nil {
+			continue
+		}
+		if stfs.Blocks == 0 {
+			continue
+		}
+		bsize := uint64(stfs.Bsize)
+		fs := FileSystem{FsName: fsName, Mount: mount}
+		fs.Total = ceilDiv(stfs.Blocks*bsize, 1024)
+		fs.Used = ceilDiv((stfs.Blocks-stfs.Bfree)*bsize, 1024)
+		fs.Free = ceilDiv(stfs.Bavail*bsize, 1024)
+		if fs.Used+fs.Free > 0 {
+			fs.UsedRate = float64(ceilDiv(fs.Used*100, fs.Used+fs.Free))
+		}
+		dev := uint64(st.Dev)
+		index, exists := devIndex[dev]
+		if !exists {
+			devIndex[dev] = len(fsList)
+			fsList = append(fsList, fs)
+		} else if len(mount) < len(fsList[index].Mount) {
+			fsList[index] = fs
+		}
+	}
+	return fsList, nil
+}
+
+func ceilDiv(a uint64, b uint64) uint64 {
+	return (a + b - 1) / b
+}
+
+///proc/mounts中空格、tab、换行、反斜杠被转义为\040 \011 \012 \134
+func unescapeMount(str string) string {
+	if !strings.Contains(str, "\\") {
+		return str
+	}
+	ret := []byte{}
+	for i := 0; i < len(str); i++ {
+		if str[i] == '\\' && i+3 < len(str) {
+			c, err := strconv.ParseUint(str[i+1:i+4], 8, 8)
+			if err == nil {
+				ret = append(ret, byte(c))
+				i += 3
+				continue
+			}
+		}
+		ret = append(ret, str[i])
+	}
+	return string(ret)
+}
+
 func (this *Disk) Dump() {
 	for _, fs := range this.FsMap {
 		fmt.Printf("FsName:%s, Total:%d, Used:%d, Free:%d, UsedRate:%f, Mount:%s\n",
@@ -143,32 +254,71 @@ func (this *Disk) MountUsedRate(mount string) string {
 	return FloatToString(fs.UsedRate)
 }
 
+//分区总空间(kb)
+func (this *Disk) MountTotal(mount string) string {
+	fs, exists := this.FsMap[mount]
+	if !exists {
+		return ""
+	}
+	return strconv.FormatUint(fs.Total, 10)
+}
+
+//分区已用空间(kb)
+func (this *Disk) MountUsed(mount string) string {
+	fs, exists := this.FsMap[mount]
+	if !exists {
+		return ""
+	}
+	return strconv.FormatUint(fs.Used, 10)
+}
+
+//分区可用空间(kb)
+func (this *Disk) MountFree(mount string) string {
+	fs, exists := this.FsMap[mount]
+	if !exists {
+		return ""
+	}
+	return strconv.FormatUint(fs.Free, 10)
+}
+
 //所有挂载分区总使用率
 func (this *Disk) DiskUsedRate(args string) string {
 	return FloatToString(this.UsedRate)
 }
 
-//机器物理磁盘信息
+//机器物理磁盘信息, 读/sys/block, 格式与fdisk -l的Disk /dev/xxx: 500.1 GB一致: /dev/sda|500.1$/dev/sdb|800$
 func DiskModel(args string) string {
-	cmd := "fdisk -l 2>/dev/null | grep 'Disk /dev/'"
-	output, err := Exec(cmd)
+	dirs, err := ioutil.ReadDir(SysPath("", "block"))
 	if err != nil {
 		return ""
 	}
-	lines := strings.Split(output, "\n")
 	models := []string{}
-	for _, line := range lines {
-		//去掉字节大小，只保留一个单位(GB或M)
-		sizes := strings.Split(line, ",")
-		if len(sizes) != 2 {
+	for _, dir := range dirs {
+		name := dir.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		content, err := GetFileContent(SysPath("", "block", name, "size"))
+		if err != nil {
 			continue
 		}
-		fields := strings.Fields(sizes[0])
-		if len(fields) != 4 {
+		sectors, err := strconv.ParseUint(strings.TrimSpace(content), 10, 64)
+		if err != nil || sectors == 0 {
 			continue
 		}
-		model := strings.Replace(fields[1], ":", "", -1)
-		capacity := fields[2]
+		model := "/dev/" + name
+		//device mapper设备显示为/dev/mapper/xxx
+		dmName, err := GetFileContent(SysPath("", "block", name, "dm", "name"))
+		if err == nil {
+			model = "/dev/mapper/" + strings.TrimSpace(dmName)
+		}
+		///sys/block/xxx/size固定以512字节为单位; 大于1GB时以GB为单位保留1位小数, 否则以MB为单位
+		bytes := sectors * 512
+		capacity := strconv.FormatUint(bytes/1000000, 10)
+		if bytes >= 1000000000 {
+			hectomega := (bytes + 50000000) / 100000000
+			capacity = strconv.FormatUint(hectomega/10, 10) + "." + strconv.FormatUint(hectomega%10, 10)
+		}
 		models = append(models, model+"|"+capacity)
 	}
 	ret := strings.Join(models, "$") + "$"
@@ -272,7 +422,68 @@ func (this *Disk) MaxUsedRateFsFunc(args string) string {
 	return FloatToString(this.MaxUseRate) + "," + this.MaxUseRateFs
 }
 
-//返回某个目录的大小(MB)
+//所有挂载点, 按名称排序
+func (this *Disk) Mounts() []string {
+	mounts := []string{}
+	for mount, _ := range this.FsMap {
+		mounts = append(mounts, mount)
+	}
+	sort.Strings(mounts)
+	return mounts
+}
+
+func (this *Disk) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "disk.mount.used.rate", Unit: "%", Type: GAUGE, Desc: "分区使用率", Label: "mount", Args: this.Mounts, Func: this.MountUsedRate},
+		{Key: "disk.mount.total", Unit: "kb", Type: GAUGE, Desc: "分区总空间", Label: "mount", Args: this.Mounts, Func: this.MountTotal},
+		{Key: "disk.mount.used", Unit: "kb", Type: GAUGE, Desc: "分区已用空间", Label: "mount", Args: this.Mounts, Func: this.MountUsed},
+		{Key: "disk.mount.free", Unit: "kb", Type: GAUGE, Desc: "分区可用空间", Label: "mount", Args: this.Mounts, Func: this.MountFree},
+		{Key: "disk.used.rate", Unit: "%", Type: GAUGE, Desc: "所有挂载分区总使用率", Func: this.DiskUsedRate},
+		{Key: "disk.used.rate.set", Type: TEXT, Desc: "磁盘所有分区使用率集合", Func: this.DiskUsedRateSet},
+		{Key: "disk.max.used.rate", Type: TEXT, Desc: "磁盘所有分区最大使用率", Func: this.MaxUsedRateFsFunc},
+		{Key: "disk.home.free", Unit: "MB", Type: GAUGE, Desc: "/home分区剩余空间", Func: this.HomeFree},
+		{Key: "disk.home.total", Unit: "MB", Type: GAUGE, Desc: "/home分区总空间", Func: this.HomeTotal},
+		{Key: "disk.home.used.rate", Unit: "%", Type: GAUGE, Desc: "/home分区空间使用率", Func: this.HomeUsedRate},
+		{Key: "disk.root.free", Unit: "MB", Type: GAUGE, Desc: "根分区剩余空间", Func: this.RootFree},
+		{Key: "disk.root.total", Unit: "MB", Type: GAUGE, Desc: "根分区总空间", Func: this.RootTotal},
+		{Key: "disk.root.used.rate", Unit: "%", Type: GAUGE, Desc: "根分区空间使用率", Func: this.RootUsedRate},
+		{Key: "disk.tmp.used.rate", Unit: "%", Type: GAUGE, Desc: "/tmp分区使用率", Func: this.TmpUsedRate},
+		{Key: "disk.usr.used.rate", Unit: "%", Type: GAUGE, Desc: "/usr分区使用率", Func: this.UsrUsedRate},
+		{Key: "disk.var.used.rate", Unit: "%", Type: GAUGE, Desc: "/var分区使用率", Func: this.VarUsedRate},
+		{Key: "disk.model", Type: TEXT, Desc: "机器物理磁盘信息", Func: DiskModel},
+		{Key: "disk.dir.used", Unit: "MB", Type: GAUGE, Desc: "某个目录的大小", Label: "dir", Func: DiskUsedByDir},
+	}
+}
+
+//返回某个目录的大小(MB), 与du -sm一致: 按占用的块统计, 硬链接只统计一次, 不跟随符号链接, 向上取整
 func DiskUsedByDir(dir string) string {
-	return ExecOutput("du -sm " + dir + "|awk '{print $1}'")
+	if _, err := os.Lstat(dir); err != nil {
+		return ""
+	}
+	type inode struct {
+		dev uint64
+		ino uint64
+	}
+	seen := map[inode]struct{}{}
+	var blocks int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			//与du一样, 跳过无权限读取的目录, 继续统计
+			return nil
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		if !info.IsDir() && st.Nlink > 1 {
+			key := inode{uint64(st.Dev), uint64(st.Ino)}
+			if _, exists := seen[key]; exists {
+				return nil
+			}
+			seen[key] = struct{}{}
+		}
+		blocks += int64(st.Blocks)
+		return nil
+	})
+	return strconv.FormatUint(ceilDiv(uint64(blocks)*512, 1024*1024), 10)
 }
@@ -1,6 +1,15 @@
 package system
 
-//dmesg出现error行数
+import (
+	"strconv"
+)
+
+//内核日志缓冲区中包含error的行数, 与原来的dmesg|grep error|wc -l一致, 每次调用都读一遍缓冲区, 不能读内核日志时返回空;
+//按级别统计一个周期新增的err及以上日志条数时使用Kmsg.ErrCountFunc
 func DmesgErrCount(args string) string {
-	return ExecOutput("dmesg|grep error|wc -l")
+	records, err := (&Kmsg{}).ReadAll()
+	if err != nil {
+		return ""
+	}
+	return strconv.Itoa(kmsgKeywordCount(records, "error"))
 }
@@ -0,0 +1,135 @@
+package system
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+//Open-Falcon/Nightingale上报数据
+type FalconItem struct {
+	Endpoint    string  `json:"endpoint"`
+	Metric      string  `json:"metric"`
+	Timestamp   int64   `json:"timestamp"`
+	Step        int64   `json:"step"`
+	Value       float64 `json:"value"`
+	CounterType string  `json:"counterType"` //GAUGE, COUNTER
+	Tags        string  `json:"tags"`        //如device=sda, interface=eth0
+}
+
+//将一次采集的结果转换为Open-Falcon上报数据, endpoint为空时使用主机名,
+//TEXT类型、非数值及NaN、Inf的指标跳过(json无法编码), 带参数的指标以Metric.Label=参数为tags
+func FalconItems(endpoint string, step int64, timestamp int64, samples []Sample) []*FalconItem {
+	if endpoint == "" {
+		endpoint, _ = os.Hostname()
+	}
+	items := []*FalconItem{}
+	for _, sample := range samples {
+		m := sample.Metric
+		if m.Type == TEXT {
+			continue
+		}
+		value, err := strconv.ParseFloat(sample.Value, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		item := &FalconItem{
+			Endpoint:    endpoint,
+			Metric:      m.Key,
+			Timestamp:   timestamp,
+			Step:        step,
+			Value:       value,
+			CounterType: m.Type,
+		}
+		if m.Label != "" {
+			item.Tags = m.Label + "=" + sample.Arg
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+//向transfer或agent的push接口批量POST上报数据, 失败时按指数退避重试
+type FalconPusher struct {
+	Url       string        //如http://127.0.0.1:1988/v1/push
+	BatchSize int           //每次POST的最大条数
+	Retry     int           //失败重试次数
+	Backoff   time.Duration //第一次重试前的等待时间, 之后每次翻倍
+	Client    *http.Client
+}
+
+func NewFalconPusher(url string) *FalconPusher {
+	return &FalconPusher{
+		Url:       url,
+		BatchSize: 200,
+		Retry:     3,
+		Backoff:   time.Second,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+//分批上报, 某一批重试后仍失败时返回错误, 之后的批次不再上报
+func (this *FalconPusher) Push(items []*FalconItem) error {
+	batchSize := this.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(items)
+	}
+	for start := 0; start < len(items); start += batchSize {
+		end := start + batchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		err := this.pushBatch(items[start:end])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *FalconPusher) pushBatch(items []*FalconItem) error {
+	body, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	backoff := this.Backoff
+	for times := 0; ; times++ {
+		retry, err := this.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || times >= this.Retry {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+//第一个返回值表示失败后是否可以重试, 网络错误及5xx可以重试
+func (this *FalconPusher) post(body []byte) (bool, error) {
+	client := this.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(this.Url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	content, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 500 {
+		return true, fmt.Errorf("push failed: %s %s", resp.Status, content)
+	}
+	if resp.StatusCode >= 300 {
+		return false, fmt.Errorf("push failed: %s %s", resp.Status, content)
+	}
+	return false, nil
+}
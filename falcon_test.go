@@ -0,0 +1,97 @@
+package system
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFalconItems(t *testing.T) {
+	gauge := &Metric{Key: "cpu.idle", Type: GAUGE}
+	labeled := &Metric{Key: "disk.io.util", Type: GAUGE, Label: "device"}
+	text := &Metric{Key: "cpu.model", Type: TEXT}
+	samples := []Sample{
+		{Metric: gauge, Value: "50.5"},
+		{Metric: labeled, Arg: "sda", Value: "25"},
+		{Metric: text, Value: "Xeon"},
+		{Metric: gauge, Value: ""},
+		{Metric: gauge, Value: "NaN"},
+		{Metric: gauge, Value: "+Inf"},
+		{Metric: gauge, Value: "-Inf"},
+	}
+	items := FalconItems("host1", 60, 1700000000, samples)
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	if items[0].Metric != "cpu.idle" || items[0].Value != 50.5 || items[0].Tags != "" || items[0].Endpoint != "host1" {
+		t.Errorf("unexpected item %+v", items[0])
+	}
+	if items[1].Tags != "device=sda" || items[1].CounterType != GAUGE {
+		t.Errorf("unexpected item %+v", items[1])
+	}
+}
+
+func TestFalconPusher(t *testing.T) {
+	var lock sync.Mutex
+	batches := [][]*FalconItem{}
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if failures > 0 {
+			//第一次返回5xx, 应重试
+			failures--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		batch := []*FalconItem{}
+		if err := json.Unmarshal(body, &batch); err != nil {
+			t.Errorf("invalid body %s: %v", body, err)
+		}
+		batches = append(batches, batch)
+	}))
+	defer server.Close()
+
+	pusher := NewFalconPusher(server.URL)
+	pusher.BatchSize = 2
+	pusher.Backoff = time.Millisecond
+	items := []*FalconItem{}
+	for _, key := range []string{"a", "b", "c"} {
+		items = append(items, &FalconItem{Endpoint: "host1", Metric: key, Timestamp: 1700000000, Step: 60, Value: 1, CounterType: GAUGE})
+	}
+	if err := pusher.Push(items); err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+	if batches[1][0].Metric != "c" {
+		t.Errorf("got metric %s, want c", batches[1][0].Metric)
+	}
+}
+
+func TestFalconPusherClientError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	pusher := NewFalconPusher(server.URL)
+	pusher.Backoff = time.Millisecond
+	if err := pusher.Push([]*FalconItem{{Metric: "a"}}); err == nil {
+		t.Fatal("want error")
+	}
+	//4xx不重试
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1", requests)
+	}
+}
@@ -0,0 +1,201 @@
+package system
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//testdata下各内核的两次采集, 期望结果见testdata/README.md
+var goldenKernels = []struct {
+	name        string
+	memUsed     uint64  //第二次采集的MemUsed
+	memUsedRate float64 //第二次采集的MemUsedRate
+	memFirst    float64 //第一次采集的MemUsedRate
+	resetIfi    string  //第二次采集时计数器重置的网卡
+	interfaces  map[string]string
+}{
+	{"kernel-3.10", 8892436, 54.67, 48.38, "", map[string]string{"eth0": "10.0.0.2/24", "eth1": "203.0.113.2/24"}},
+	{"kernel-4.18", 9265236, 56.96, 50.00, "", map[string]string{"eth0": "10.0.0.2/24"}},
+	{"kernel-5.10", 9265236, 56.96, 50.00, "", map[string]string{"ens5": "172.31.0.2/20"}},
+	{"kernel-6.8", 9265236, 56.96, 50.00, "enp2s0", map[string]string{"enp1s0": "192.168.1.2/24", "enp2s0": "203.0.113.3/24"}},
+}
+
+//间隔秒数
+const goldenInterval = 10
+
+//固定的采集时间, 第一次采集为开机时间, 每次Tick前进goldenInterval秒
+type goldenClock struct {
+	now time.Time
+}
+
+func newGoldenClock() *goldenClock {
+	return &goldenClock{now: time.Unix(1700000000, 0)}
+}
+
+func (this *goldenClock) Now() time.Time {
+	return this.now
+}
+
+func (this *goldenClock) Tick() {
+	this.now = this.now.Add(goldenInterval * time.Second)
+}
+
+func goldenProcRoot(kernel string, snapshot string) string {
+	return filepath.Join("testdata", kernel, snapshot, "proc")
+}
+
+func assertFloat(t *testing.T, name string, got float64, want float64, precision float64) {
+	t.Helper()
+	if math.Abs(got-want) > precision {
+		t.Errorf("%s = %f, want %f", name, got, want)
+	}
+}
+
+func TestGoldenCpu(t *testing.T) {
+	for _, k := range goldenKernels {
+		t.Run(k.name, func(t *testing.T) {
+			clock := newGoldenClock()
+			c := &Cpu{ProcRoot: goldenProcRoot(k.name, "1"), Now: clock.Now}
+			if err := c.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			assertFloat(t, "first UserRate", c.UserRate, 0, 0)
+			assertFloat(t, "first IdleRate", c.IdleRate, 0, 0)
+			assertFloat(t, "first CtxtPerSecond", c.CtxtPerSecond, 0, 0)
+			assertFloat(t, "first ForkPerSecond", c.ForkPerSecond, 0, 0)
+
+			c.ProcRoot = goldenProcRoot(k.name, "2")
+			clock.Tick()
+			if err := c.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			assertFloat(t, "UserRate", c.UserRate, 30, 0.001)
+			assertFloat(t, "SystemRate", c.SystemRate, 10, 0.001)
+			assertFloat(t, "IoWaitRate", c.IoWaitRate, 10, 0.001)
+			assertFloat(t, "IdleRate", c.IdleRate, 50, 0.001)
+			assertFloat(t, "CtxtPerSecond", c.CtxtPerSecond, 4500, 0.001)
+			assertFloat(t, "ForkPerSecond", c.ForkPerSecond, 12, 0.001)
+			assertFloat(t, "IntrPerSecond", c.IntrPerSecond, 0, 0)
+			if c.ProcsRunning != 3 || c.ProcsBlocked != 1 {
+				t.Errorf("ProcsRunning = %d, ProcsBlocked = %d, want 3, 1", c.ProcsRunning, c.ProcsBlocked)
+			}
+			if c.Btime != 1700000000 {
+				t.Errorf("Btime = %d, want 1700000000", c.Btime)
+			}
+			if len(c.CoreIndexes) == 0 {
+				t.Fatal("no cpu core")
+			}
+			for _, index := range c.CoreIndexes {
+				assertFloat(t, "core UsedRate", c.CoreMap[index].UsedRate, 40, 0.001)
+			}
+		})
+	}
+}
+
+func TestGoldenMem(t *testing.T) {
+	for _, k := range goldenKernels {
+		t.Run(k.name, func(t *testing.T) {
+			m := &Mem{ProcRoot: goldenProcRoot(k.name, "1")}
+			if err := m.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			assertFloat(t, "first MemUsedRate", m.MemUsedRate, k.memFirst, 0.005)
+
+			m.ProcRoot = goldenProcRoot(k.name, "2")
+			if err := m.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			if m.MemUsed != k.memUsed {
+				t.Errorf("MemUsed = %d, want %d", m.MemUsed, k.memUsed)
+			}
+			assertFloat(t, "MemUsedRate", m.MemUsedRate, k.memUsedRate, 0.005)
+			assertFloat(t, "SwapUsedRate", m.SwapUsedRate, 25, 0.005)
+		})
+	}
+}
+
+func TestGoldenDiskIO(t *testing.T) {
+	for _, k := range goldenKernels {
+		t.Run(k.name, func(t *testing.T) {
+			clock := newGoldenClock()
+			d := &DiskIO{ProcRoot: goldenProcRoot(k.name, "1"), Now: clock.Now}
+			if err := d.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			if len(d.PartiNames) == 0 {
+				t.Fatal("no partition")
+			}
+			for _, name := range d.PartiNames {
+				parti := d.PartiMap[name]
+				assertFloat(t, name+" first AwaitElapsed", parti.AwaitElapsed, 0, 0)
+				assertFloat(t, name+" first ReqRate", parti.ReqRate, 0, 0)
+			}
+
+			clock.Tick()
+			d.ProcRoot = goldenProcRoot(k.name, "2")
+			if err := d.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range d.PartiNames {
+				parti := d.PartiMap[name]
+				assertFloat(t, name+" AwaitElapsed", parti.AwaitElapsed, 4, 0.001)
+				assertFloat(t, name+" ServeElapsed", parti.ServeElapsed, 5, 0.001)
+				assertFloat(t, name+" ReqSz", parti.ReqSz, 19.2, 0.001)
+				assertFloat(t, name+" ReqRate", parti.ReqRate, 25, 0.001)
+			}
+		})
+	}
+}
+
+func TestGoldenNetWork(t *testing.T) {
+	for _, k := range goldenKernels {
+		t.Run(k.name, func(t *testing.T) {
+			clock := newGoldenClock()
+			n := &NetWork{
+				ProcRoot:   goldenProcRoot(k.name, "1"),
+				SysRoot:    filepath.Join("testdata", k.name, "1", "sys"),
+				Interfaces: k.interfaces,
+				Now:        clock.Now,
+			}
+			if err := n.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			//只监控Interfaces中的网卡, 与运行测试的机器无关
+			if len(n.IfiNames) != len(k.interfaces) {
+				t.Fatalf("got interfaces %v, want %v", n.IfiNames, k.interfaces)
+			}
+			for _, name := range n.IfiNames {
+				ifi := n.IfiMap[name]
+				assertFloat(t, name+" first RecvByteAvg", ifi.RecvByteAvg, 0, 0)
+				assertFloat(t, name+" first SendByteAvg", ifi.SendByteAvg, 0, 0)
+			}
+
+			clock.Tick()
+			n.ProcRoot = goldenProcRoot(k.name, "2")
+			n.SysRoot = filepath.Join("testdata", k.name, "2", "sys")
+			if err := n.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			if _, exists := n.IfiMap[k.resetIfi]; k.resetIfi != "" && !exists {
+				t.Fatalf("%s not found", k.resetIfi)
+			}
+			for _, name := range n.IfiNames {
+				ifi := n.IfiMap[name]
+				if ifi.Ip != k.interfaces[name] {
+					t.Errorf("%s Ip = %s, want %s", name, ifi.Ip, k.interfaces[name])
+				}
+				if name == k.resetIfi {
+					assertFloat(t, name+" RecvByteAvg", ifi.RecvByteAvg, 0, 0)
+					assertFloat(t, name+" SendByteAvg", ifi.SendByteAvg, 0, 0)
+					assertFloat(t, name+" RecvErrRate", ifi.RecvErrRate, 0, 0)
+					continue
+				}
+				assertFloat(t, name+" RecvByteAvg", ifi.RecvByteAvg, 1048576, 0.001)
+				assertFloat(t, name+" SendByteAvg", ifi.SendByteAvg, 209715.2, 0.001)
+				assertFloat(t, name+" RecvErrRate", ifi.RecvErrRate, 0.001, 0.000001)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package system
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//按Graphite plaintext格式输出: prefix.指标key[.参数] 值 时间戳,
+//参数中的/、.、空格替换为_, 根分区/为_root, TEXT类型、非数值及NaN/Inf的指标跳过
+func WriteGraphite(w io.Writer, prefix string, samples []Sample, timestamp time.Time) error {
+	writer := bufio.NewWriter(w)
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	for _, sample := range samples {
+		m := sample.Metric
+		if m.Type == TEXT {
+			continue
+		}
+		value, err := strconv.ParseFloat(sample.Value, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		path := m.Key
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		if m.Label != "" && sample.Arg != "" {
+			path += "." + GraphiteNode(sample.Arg)
+		}
+		writer.WriteString(path + " " + strconv.FormatFloat(value, 'f', -1, 64) + " " + ts + "\n")
+	}
+	return writer.Flush()
+}
+
+//将分区名、挂载点等转换为graphite路径中的一段, 根目录/为_root, 与挂载点/root区分
+func GraphiteNode(str string) string {
+	str = strings.Trim(str, "/")
+	if str == "" {
+		return "_root"
+	}
+	return strings.NewReplacer("/", "_", ".", "_", " ", "_").Replace(str)
+}
@@ -0,0 +1,46 @@
+package system
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteGraphite(t *testing.T) {
+	gauge := &Metric{Key: "cpu.idle", Type: GAUGE}
+	labeled := &Metric{Key: "disk.used", Type: GAUGE, Label: "mount"}
+	text := &Metric{Key: "cpu.model", Type: TEXT}
+	samples := []Sample{
+		{Metric: gauge, Value: "50.5"},
+		{Metric: labeled, Arg: "/", Value: "25"},
+		{Metric: text, Value: "Xeon"},
+		{Metric: gauge, Value: ""},
+		{Metric: gauge, Value: "NaN"},
+		{Metric: gauge, Value: "+Inf"},
+		{Metric: gauge, Value: "-Inf"},
+	}
+	buf := bytes.Buffer{}
+	if err := WriteGraphite(&buf, "system", samples, time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	want := "system.cpu.idle 50.5 1700000000\nsystem.disk.used._root 25 1700000000\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestGraphiteNode(t *testing.T) {
+	cases := map[string]string{
+		"/":          "_root",
+		"/root":      "root",
+		"/data/logs": "data_logs",
+		"sda1":       "sda1",
+		"eth0.100":   "eth0_100",
+		"my disk":    "my_disk",
+	}
+	for str, want := range cases {
+		if got := GraphiteNode(str); got != want {
+			t.Errorf("GraphiteNode(%q) = %s, want %s", str, got, want)
+		}
+	}
+}
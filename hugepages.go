@@ -0,0 +1,287 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//某种大小的大页池
+type HugePagePool struct {
+	Node       int    //NUMA节点, 为-1时为所有节点合计
+	Size       uint64 //大页大小(kb)
+	Total      uint64 //大页总数
+	Free       uint64 //未分配的大页数
+	Rsvd       uint64 //已承诺分配但还未使用的大页数, 节点池没有
+	Surp       uint64 //超过nr_hugepages临时分配的大页数
+	Overcommit uint64 //最多可临时分配的大页数, 节点池没有
+}
+
+//大页池名称, 如2048kB, 节点池为node0-2048kB
+func (this *HugePagePool) Name() string {
+	name := strconv.FormatUint(this.Size, 10) + "kB"
+	if this.Node >= 0 {
+		name = "node" + strconv.Itoa(this.Node) + "-" + name
+	}
+	return name
+}
+
+//已分配的大页占比(%)
+func (this *HugePagePool) UsedRate() float64 {
+	if this.Total == 0 {
+		return 0
+	}
+	return float64(this.Total-this.Free) / float64(this.Total) * 100
+}
+
+//读/sys/kernel/mm/hugepages及/sys/devices/system/node/node*/hugepages, 采集每种大小及每个NUMA节点的大页池,
+//以及/sys/kernel/mm/transparent_hugepage的透明大页模式, 默认大小的大页合计见Mem.HugePagesTotal等
+type HugePages struct {
+	PoolMap       map[string]*HugePagePool //大页池名称=>大页池
+	PoolNames     []string                 //所有节点合计的大页池名称, 按大小排序
+	NodePoolNames []string                 //每个节点的大页池名称, 格式为node<节点编号>-<大小>kB, 如node0-2048kB, 按节点、大小排序
+	ThpEnabled    string                   //透明大页模式, always、madvise或never, 内核不支持时为空
+	ThpDefrag     string                   //透明大页缺页时的规整策略, 如madvise、defer+madvise
+	ThpEnabledAll []string                 //内核支持的透明大页模式
+	ThpDefragAll  []string                 //内核支持的规整策略, 老内核没有defer、defer+madvise
+	SysRoot       string                   //sysfs根目录, 为空时使用SysRoot
+}
+
+func (this *HugePages) Dump() {
+	for _, name := range append(this.Names(), this.NodeNames()...) {
+		pool := this.PoolMap[name]
+		fmt.Printf("hugepages:%s, Total:%d, Free:%d, Rsvd:%d, Surp:%d, Overcommit:%d\n",
+			name,
+			pool.Total,
+			pool.Free,
+			pool.Rsvd,
+			pool.Surp,
+			pool.Overcommit)
+	}
+	fmt.Printf("THP enabled:%s, defrag:%s\n", this.ThpEnabled, this.ThpDefrag)
+}
+
+func (this *HugePages) Collect() error {
+	poolMap := map[string]*HugePagePool{}
+	pools := readHugePagePools(SysPath(this.SysRoot, "kernel", "mm", "hugepages"), -1)
+	names := []string{}
+	for _, pool := range pools {
+		poolMap[pool.Name()] = pool
+		names = append(names, pool.Name())
+	}
+	nodeNames := []string{}
+	nodeDirs, _ := ioutil.ReadDir(SysPath(this.SysRoot, "devices", "system", "node"))
+	nodes := []int{}
+	for _, dir := range nodeDirs {
+		node, err := strconv.Atoi(strings.TrimPrefix(dir.Name(), "node"))
+		if err == nil && strings.HasPrefix(dir.Name(), "node") {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Ints(nodes)
+	for _, node := range nodes {
+		dir := SysPath(this.SysRoot, "devices", "system", "node", "node"+strconv.Itoa(node), "hugepages")
+		for _, pool := range readHugePagePools(dir, node) {
+			poolMap[pool.Name()] = pool
+			nodeNames = append(nodeNames, pool.Name())
+		}
+	}
+	this.PoolMap = poolMap
+	this.PoolNames = names
+	this.NodePoolNames = nodeNames
+
+	this.ThpEnabled, this.ThpEnabledAll = "", []string{}
+	this.ThpDefrag, this.ThpDefragAll = "", []string{}
+	if content, err := GetFileContent(SysPath(this.SysRoot, "kernel", "mm", "transparent_hugepage", "enabled")); err == nil {
+		this.ThpEnabled, this.ThpEnabledAll = thpMode(content)
+	}
+	if content, err := GetFileContent(SysPath(this.SysRoot, "kernel", "mm", "transparent_hugepage", "defrag")); err == nil {
+		this.ThpDefrag, this.ThpDefragAll = thpMode(content)
+	}
+	if len(names) == 0 && this.ThpEnabled == "" {
+		//区分内核不支持大页与sysfs根目录错误
+		if _, err := os.Stat(SysPath(this.SysRoot, "kernel")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//读hugepages-2048kB这样的目录, 按大小排序
+func readHugePagePools(dir string, node int) []*HugePagePool {
+	pools := []*HugePagePool{}
+	dirs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return pools
+	}
+	for _, d := range dirs {
+		name := d.Name()
+		if !strings.HasPrefix(name, "hugepages-") || !strings.HasSuffix(name, "kB") {
+			continue
+		}
+		size, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		value := func(file string) uint64 {
+			content, err := GetFileContent(filepath.Join(dir, name, file))
+			if err != nil {
+				return 0
+			}
+			v, _ := strconv.ParseUint(strings.TrimSpace(content), 10, 64)
+			return v
+		}
+		pools = append(pools, &HugePagePool{
+			Node:       node,
+			Size:       size,
+			Total:      value("nr_hugepages"),
+			Free:       value("free_hugepages"),
+			Rsvd:       value("resv_hugepages"),
+			Surp:       value("surplus_hugepages"),
+			Overcommit: value("nr_overcommit_hugepages"),
+		})
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Size < pools[j].Size })
+	return pools
+}
+
+//取方括号中的当前模式及所有模式, 如always [madvise] never
+func thpMode(content string) (string, []string) {
+	mode := ""
+	modes := []string{}
+	for _, field := range strings.Fields(content) {
+		if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+			field = strings.Trim(field, "[]")
+			mode = field
+		}
+		modes = append(modes, field)
+	}
+	return mode, modes
+}
+
+//所有节点合计的大页池名称
+func (this *HugePages) Names() []string {
+	return append([]string{}, this.PoolNames...)
+}
+
+//每个节点的大页池名称, 如node0-2048kB
+func (this *HugePages) NodeNames() []string {
+	return append([]string{}, this.NodePoolNames...)
+}
+
+//按名称取大页池, 如2048kB、node0-2048kB, 也可传2048、2M、1G
+func (this *HugePages) GetPoolByIndex(args string) (*HugePagePool, error) {
+	if pool, exists := this.PoolMap[args]; exists {
+		return pool, nil
+	}
+	prefix := ""
+	if pos := strings.LastIndex(args, "-"); pos >= 0 {
+		prefix, args = args[:pos+1], args[pos+1:]
+	}
+	pool, exists := this.PoolMap[prefix+strconv.FormatUint(parseHugePageSize(args), 10)+"kB"]
+	if !exists {
+		return nil, errors.New("hugepage pool not found")
+	}
+	return pool, nil
+}
+
+//2048、2M、1G这样的大小, 单位为kb
+func parseHugePageSize(str string) uint64 {
+	str = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(str)), "B")
+	unit := uint64(1)
+	if strings.HasSuffix(str, "K") {
+		str = strings.TrimSuffix(str, "K")
+	} else if strings.HasSuffix(str, "M") {
+		str = strings.TrimSuffix(str, "M")
+		unit = 1024
+	} else if strings.HasSuffix(str, "G") {
+		str = strings.TrimSuffix(str, "G")
+		unit = 1024 * 1024
+	}
+	size, _ := strconv.ParseUint(str, 10, 64)
+	return size * unit
+}
+
+func (this *HugePages) poolFunc(value func(pool *HugePagePool) string) MetricFunc {
+	return func(args string) string {
+		pool, err := this.GetPoolByIndex(args)
+		if err != nil {
+			return ""
+		}
+		return value(pool)
+	}
+}
+
+//透明大页模式
+func (this *HugePages) ThpEnabledFunc(args string) string {
+	return this.ThpEnabled
+}
+
+//透明大页缺页时的规整策略
+func (this *HugePages) ThpDefragFunc(args string) string {
+	return this.ThpDefrag
+}
+
+//内核支持的透明大页模式
+func (this *HugePages) ThpEnabledModes() []string {
+	return append([]string{}, this.ThpEnabledAll...)
+}
+
+//内核支持的规整策略
+func (this *HugePages) ThpDefragModes() []string {
+	return append([]string{}, this.ThpDefragAll...)
+}
+
+//透明大页模式为args时返回1, 否则返回0
+func (this *HugePages) ThpEnabledModeFunc(args string) string {
+	return thpModeValue(this.ThpEnabled, this.ThpEnabledAll, args)
+}
+
+//规整策略为args时返回1, 否则返回0
+func (this *HugePages) ThpDefragModeFunc(args string) string {
+	return thpModeValue(this.ThpDefrag, this.ThpDefragAll, args)
+}
+
+//当前模式为args时返回1, 否则返回0, 内核不支持该模式时返回空
+func thpModeValue(mode string, modes []string, args string) string {
+	for _, m := range modes {
+		if m == args {
+			if m == mode {
+				return "1"
+			}
+			return "0"
+		}
+	}
+	return ""
+}
+
+func (this *HugePages) Metrics() []*Metric {
+	total := func(pool *HugePagePool) string { return strconv.FormatUint(pool.Total, 10) }
+	free := func(pool *HugePagePool) string { return strconv.FormatUint(pool.Free, 10) }
+	rsvd := func(pool *HugePagePool) string { return strconv.FormatUint(pool.Rsvd, 10) }
+	surp := func(pool *HugePagePool) string { return strconv.FormatUint(pool.Surp, 10) }
+	overcommit := func(pool *HugePagePool) string { return strconv.FormatUint(pool.Overcommit, 10) }
+	usedRate := func(pool *HugePagePool) string { return FloatToString(pool.UsedRate()) }
+	return []*Metric{
+		{Key: "hugepages.total", Type: GAUGE, Desc: "大页总数", Label: "size", Args: this.Names, Func: this.poolFunc(total)},
+		{Key: "hugepages.free", Type: GAUGE, Desc: "未分配的大页数", Label: "size", Args: this.Names, Func: this.poolFunc(free)},
+		{Key: "hugepages.rsvd", Type: GAUGE, Desc: "已承诺分配但还未使用的大页数", Label: "size", Args: this.Names, Func: this.poolFunc(rsvd)},
+		{Key: "hugepages.surp", Type: GAUGE, Desc: "超过nr_hugepages临时分配的大页数", Label: "size", Args: this.Names, Func: this.poolFunc(surp)},
+		{Key: "hugepages.overcommit", Type: GAUGE, Desc: "最多可临时分配的大页数", Label: "size", Args: this.Names, Func: this.poolFunc(overcommit)},
+		{Key: "hugepages.used.rate", Unit: "%", Type: GAUGE, Desc: "已分配的大页占比", Label: "size", Args: this.Names, Func: this.poolFunc(usedRate)},
+		//节点池的pool参数格式为node<节点编号>-<大小>kB, 如node0-2048kB
+		{Key: "hugepages.node.total", Type: GAUGE, Desc: "NUMA节点上的大页总数", Label: "pool", Args: this.NodeNames, Func: this.poolFunc(total)},
+		{Key: "hugepages.node.free", Type: GAUGE, Desc: "NUMA节点上未分配的大页数", Label: "pool", Args: this.NodeNames, Func: this.poolFunc(free)},
+		{Key: "hugepages.node.surp", Type: GAUGE, Desc: "NUMA节点上临时分配的大页数", Label: "pool", Args: this.NodeNames, Func: this.poolFunc(surp)},
+		{Key: "hugepages.node.used.rate", Unit: "%", Type: GAUGE, Desc: "NUMA节点上已分配的大页占比", Label: "pool", Args: this.NodeNames, Func: this.poolFunc(usedRate)},
+		{Key: "hugepages.thp.enabled", Type: TEXT, Desc: "透明大页模式", Func: this.ThpEnabledFunc},
+		{Key: "hugepages.thp.defrag", Type: TEXT, Desc: "透明大页缺页时的规整策略", Func: this.ThpDefragFunc},
+		{Key: "hugepages.thp.enabled.mode", Type: GAUGE, Desc: "透明大页是否为该模式, 是为1", Label: "mode", Args: this.ThpEnabledModes, Func: this.ThpEnabledModeFunc},
+		{Key: "hugepages.thp.defrag.mode", Type: GAUGE, Desc: "透明大页规整策略是否为该策略, 是为1", Label: "mode", Args: this.ThpDefragModes, Func: this.ThpDefragModeFunc},
+	}
+}
@@ -0,0 +1,42 @@
+package system
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHugePagesThpMode(t *testing.T) {
+	h := &HugePages{SysRoot: filepath.Join("testdata", "cpuinfo-x86", "sys")}
+	registry := NewRegistry()
+	if err := registry.Register("hugepages", h); err != nil {
+		t.Fatal(err)
+	}
+	registry.Collect()
+	values := map[string]string{}
+	for _, sample := range registry.Samples() {
+		switch sample.Metric.Key {
+		case "hugepages.thp.enabled.mode", "hugepages.thp.defrag.mode", "hugepages.node.total":
+			values[sample.Metric.Key+"["+sample.Arg+"]"] = sample.Value
+		}
+	}
+	want := map[string]string{
+		"hugepages.thp.enabled.mode[always]":       "0",
+		"hugepages.thp.enabled.mode[madvise]":      "1",
+		"hugepages.thp.enabled.mode[never]":        "0",
+		"hugepages.thp.defrag.mode[always]":        "0",
+		"hugepages.thp.defrag.mode[defer]":         "0",
+		"hugepages.thp.defrag.mode[defer+madvise]": "0",
+		"hugepages.thp.defrag.mode[madvise]":       "1",
+		"hugepages.thp.defrag.mode[never]":         "0",
+		"hugepages.node.total[node0-2048kB]":       "2048",
+		"hugepages.node.total[node1-1048576kB]":    "2",
+	}
+	for key, value := range want {
+		if values[key] != value {
+			t.Errorf("%s = %s, want %s", key, values[key], value)
+		}
+	}
+	if value := h.ThpEnabledModeFunc("unknown"); value != "" {
+		t.Errorf("unknown mode = %s, want empty", value)
+	}
+}
@@ -0,0 +1,104 @@
+package system
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//按InfluxDB line protocol输出, 每个采集器一个measurement, 带参数的指标以Metric.Label=参数为tag,
+//field名为指标key(.替换为_), COUNTER为整数, 其他为浮点数, TEXT类型、非数值及NaN、Inf的指标跳过
+func WriteInflux(w io.Writer, samples []Sample, tags map[string]string, timestamp time.Time) error {
+	type point struct {
+		measurement string
+		tags        string
+		fields      []string
+	}
+	//公共tag按名称排序, influx推荐按tag名排序写入
+	names := []string{}
+	for name, _ := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	commonTags := ""
+	for _, name := range names {
+		commonTags += "," + escapeInflux(name, false) + "=" + escapeInflux(tags[name], false)
+	}
+
+	points := []*point{}
+	pointMap := map[string]*point{} //measurement+tags=>point
+	for _, sample := range samples {
+		m := sample.Metric
+		if m.Type == TEXT {
+			continue
+		}
+		field := escapeInflux(strings.Replace(m.Key, ".", "_", -1), false) + "="
+		if m.Type == COUNTER {
+			value, err := strconv.ParseInt(sample.Value, 10, 64)
+			if err != nil {
+				continue
+			}
+			field += strconv.FormatInt(value, 10) + "i"
+		} else {
+			value, err := strconv.ParseFloat(sample.Value, 64)
+			if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+				//line protocol不支持NaN、Inf, 整行会被拒绝
+				continue
+			}
+			field += strconv.FormatFloat(value, 'f', -1, 64)
+		}
+		pointTags := commonTags
+		if m.Label != "" && sample.Arg != "" {
+			pointTags = insertInfluxTag(names, tags, m.Label, sample.Arg)
+		}
+		key := m.Collector + pointTags
+		p, exists := pointMap[key]
+		if !exists {
+			p = &point{measurement: escapeInflux(m.Collector, true), tags: pointTags}
+			pointMap[key] = p
+			points = append(points, p)
+		}
+		p.fields = append(p.fields, field)
+	}
+
+	writer := bufio.NewWriter(w)
+	ts := strconv.FormatInt(timestamp.UnixNano(), 10)
+	for _, p := range points {
+		writer.WriteString(p.measurement + p.tags + " " + strings.Join(p.fields, ",") + " " + ts + "\n")
+	}
+	return writer.Flush()
+}
+
+//公共tag加上指标自身的tag, 按tag名排序, 同名时以指标自身的为准
+func insertInfluxTag(names []string, tags map[string]string, label string, arg string) string {
+	all := map[string]string{label: arg}
+	for _, name := range names {
+		if name != label {
+			all[name] = tags[name]
+		}
+	}
+	allNames := []string{}
+	for name, _ := range all {
+		allNames = append(allNames, name)
+	}
+	sort.Strings(allNames)
+	ret := ""
+	for _, name := range allNames {
+		ret += "," + escapeInflux(name, false) + "=" + escapeInflux(all[name], false)
+	}
+	return ret
+}
+
+//measurement中转义逗号和空格, tag、field名及tag值中还需转义等号
+func escapeInflux(str string, measurement bool) string {
+	str = strings.Replace(str, ",", "\\,", -1)
+	str = strings.Replace(str, " ", "\\ ", -1)
+	if !measurement {
+		str = strings.Replace(str, "=", "\\=", -1)
+	}
+	return str
+}
@@ -0,0 +1,28 @@
+package system
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteInflux(t *testing.T) {
+	samples := []Sample{
+		{Metric: &Metric{Collector: "cpu", Key: "cpu.idle", Type: GAUGE}, Value: "50.5"},
+		{Metric: &Metric{Collector: "cpu", Key: "cpu.ctxt", Type: COUNTER}, Value: "100"},
+		{Metric: &Metric{Collector: "cpu", Key: "cpu.nan", Type: GAUGE}, Value: "NaN"},
+		{Metric: &Metric{Collector: "cpu", Key: "cpu.inf", Type: GAUGE}, Value: "+Inf"},
+		{Metric: &Metric{Collector: "cpu", Key: "cpu.model", Type: TEXT}, Value: "Xeon"},
+		{Metric: &Metric{Collector: "disk", Key: "disk.io.util", Type: GAUGE, Label: "device"}, Arg: "sda", Value: "-Inf"},
+		{Metric: &Metric{Collector: "disk", Key: "disk.io.await", Type: GAUGE, Label: "device"}, Arg: "sda", Value: "4"},
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteInflux(buf, samples, map[string]string{"host": "host1"}, time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	want := "cpu,host=host1 cpu_idle=50.5,cpu_ctxt=100i 1700000000000000000\n" +
+		"disk,device=sda,host=host1 disk_io_await=4 1700000000000000000\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,376 @@
+package system
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//某个cpu处理某中断的默认占比上限, 单位%, 即90%
+const defaultIrqImbalanceRate = 90
+
+type Irq struct {
+	Name   string   //中断号, 或NMI、LOC等名称
+	Device string   //设备名, 如eth0-TxRx-0, 多个设备共享时以逗号分隔, NMI、LOC等为描述
+	Counts []uint64 //从系统启动后累加的每个cpu中断次数, 与Interrupts.Cpus顺序一致
+
+	//计算得出
+	PerSecond  []float64 //一个周期每个cpu平均每秒中断次数
+	Total      float64   //一个周期平均每秒中断次数
+	MaxCpu     int       //处理次数最多的cpu编号
+	MaxShare   float64   //处理次数最多的cpu的占比(%)
+	Imbalanced bool      //多核时某个cpu占比超过Interrupts.ImbalanceRate
+	Last       int64     //上次采集时间
+}
+
+//读/proc/interrupts, 统计每个中断在每个cpu上的次数
+type Interrupts struct {
+	IrqMap        map[string]*Irq //中断名称=>中断
+	IrqNames      []string        //中断名称, 与文件中顺序一致
+	Cpus          []int           //cpu编号, 来自表头, 离线的cpu不出现
+	CpuPerSecond  []float64       //一个周期每个cpu平均每秒处理的中断次数, 与Cpus顺序一致
+	ImbalanceRate float64         //不均衡阈值, 单位%: 某个cpu处理某中断的占比(Irq.MaxShare)超过该值时认为不均衡, 超过N%即设为N(90表示90%, 不是0.9), 为0时使用90
+	ProcRoot      string          //procfs根目录, 为空时使用ProcRoot
+}
+
+func (this *Interrupts) Dump() {
+	for _, name := range this.IrqNames {
+		irq := this.IrqMap[name]
+		fmt.Printf("irq:%s, device:%s, total:%f, maxCpu:%d, maxShare:%f, imbalanced:%v\n",
+			irq.Name,
+			irq.Device,
+			irq.Total,
+			irq.MaxCpu,
+			irq.MaxShare,
+			irq.Imbalanced)
+	}
+}
+
+func (this *Interrupts) Collect() error {
+	f, err := os.Open(ProcPath(this.ProcRoot, "interrupts"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if this.IrqMap == nil {
+		this.IrqMap = map[string]*Irq{}
+	}
+	imbalanceRate := this.ImbalanceRate
+	if imbalanceRate <= 0 {
+		imbalanceRate = defaultIrqImbalanceRate
+	}
+	reader := bufio.NewReader(f)
+	//表头, 如CPU0 CPU1 CPU3
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	cpus := []int{}
+	for _, field := range strings.Fields(header) {
+		index, err := strconv.Atoi(strings.TrimPrefix(field, "CPU"))
+		if err != nil {
+			return errors.New("invalid interrupts header: " + header)
+		}
+		cpus = append(cpus, index)
+	}
+	//cpu上下线后列对不上, 所有中断按第一次采集处理
+	cpuChanged := len(cpus) != len(this.Cpus)
+	for i := 0; !cpuChanged && i < len(cpus); i++ {
+		cpuChanged = cpus[i] != this.Cpus[i]
+	}
+	cpuPerSecond := make([]float64, len(cpus))
+
+	now := time.Now().Unix()
+	names := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+		name := strings.TrimSuffix(fields[0], ":")
+		//ERR、MIS只有一列
+		counts := make([]uint64, len(cpus))
+		n := 0
+		for ; n < len(cpus) && n+1 < len(fields); n++ {
+			count, err := strconv.ParseUint(fields[n+1], 10, 64)
+			if err != nil {
+				break
+			}
+			counts[n] = count
+		}
+		irq, exists := this.IrqMap[name]
+		if !exists {
+			irq = &Irq{Name: name}
+			this.IrqMap[name] = irq
+		}
+		irq.Device = irqDevice(name, fields[n+1:])
+
+		perSecond := make([]float64, len(cpus))
+		var total float64
+		difftime := float64(now - irq.Last)
+		if irq.Last > 0 && !cpuChanged && len(irq.Counts) == len(counts) && difftime > 0 {
+			for i := range counts {
+				perSecond[i] = float64(CounterDiff(counts[i], irq.Counts[i])) / difftime
+				total += perSecond[i]
+				cpuPerSecond[i] += perSecond[i]
+			}
+		}
+		irq.Counts = counts
+		irq.PerSecond = perSecond
+		irq.Total = total
+		irq.MaxCpu = 0
+		irq.MaxShare = 0
+		irq.Imbalanced = false
+		if total > 0 {
+			max := 0
+			for i := range perSecond {
+				if perSecond[i] > perSecond[max] {
+					max = i
+				}
+			}
+			irq.MaxCpu = cpus[max]
+			irq.MaxShare = perSecond[max] / total * 100
+			irq.Imbalanced = len(cpus) > 1 && irq.MaxShare > imbalanceRate
+		}
+		irq.Last = now
+		names = append(names, name)
+	}
+	//去掉已不存在的中断, 如卸载了驱动
+	exists := map[string]bool{}
+	for _, name := range names {
+		exists[name] = true
+	}
+	for name := range this.IrqMap {
+		if !exists[name] {
+			delete(this.IrqMap, name)
+		}
+	}
+	this.IrqNames = names
+	this.Cpus = cpus
+	this.CpuPerSecond = cpuPerSecond
+	return nil
+}
+
+//中断次数之后的列, 数字中断依次为中断控制器、硬件中断号及触发方式(老内核合并为一列, 如IO-APIC-edge)、设备名,
+//NMI、LOC等为描述
+func irqDevice(name string, fields []string) string {
+	if _, err := strconv.Atoi(name); err != nil || len(fields) == 0 {
+		return strings.Join(fields, " ")
+	}
+	fields = fields[1:]
+	for len(fields) > 0 {
+		field := fields[0]
+		pos := strings.Index(field, "-")
+		if pos > 0 {
+			field = field[:pos]
+		}
+		_, err := strconv.ParseUint(field, 10, 64)
+		if err != nil && field != "Level" && field != "Edge" {
+			break
+		}
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " ")
+}
+
+//按中断名称取中断, 也可传设备名, 如eth0-TxRx-0
+func (this *Interrupts) GetIrqByIndex(args string) (*Irq, error) {
+	if irq, exists := this.IrqMap[args]; exists {
+		return irq, nil
+	}
+	for _, name := range this.IrqNames {
+		irq := this.IrqMap[name]
+		if irq.Device == args {
+			return irq, nil
+		}
+	}
+	return nil, errors.New("irq not found")
+}
+
+//所有中断名称
+func (this *Interrupts) Names() []string {
+	return append([]string{}, this.IrqNames...)
+}
+
+//某中断在某个cpu上平均每秒次数, name为中断名称或设备名
+func (this *Interrupts) PerSecondByCpu(name string, cpu int) (float64, error) {
+	irq, err := this.GetIrqByIndex(name)
+	if err != nil {
+		return 0, err
+	}
+	for i, index := range this.Cpus {
+		if index == cpu && i < len(irq.PerSecond) {
+			return irq.PerSecond[i], nil
+		}
+	}
+	return 0, errors.New("cpu not found")
+}
+
+//所有中断名称与cpu的组合, 如25:cpu3
+func (this *Interrupts) IrqCpus() []string {
+	ret := []string{}
+	for _, name := range this.IrqNames {
+		for _, index := range this.Cpus {
+			ret = append(ret, fmt.Sprintf("%s:cpu%d", name, index))
+		}
+	}
+	return ret
+}
+
+//所有cpu编号
+func (this *Interrupts) CpuNames() []string {
+	names := []string{}
+	for _, index := range this.Cpus {
+		names = append(names, strconv.Itoa(index))
+	}
+	return names
+}
+
+//不均衡的中断
+func (this *Interrupts) ImbalancedIrqs() []*Irq {
+	irqs := []*Irq{}
+	for _, name := range this.IrqNames {
+		irq := this.IrqMap[name]
+		if irq.Imbalanced {
+			irqs = append(irqs, irq)
+		}
+	}
+	return irqs
+}
+
+//平均每秒中断次数
+func (this *Interrupts) IrqPerSecondFunc(args string) string {
+	irq, err := this.GetIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return FloatToString(irq.Total)
+}
+
+//累计中断次数
+func (this *Interrupts) IrqCountFunc(args string) string {
+	irq, err := this.GetIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	var count uint64
+	for _, c := range irq.Counts {
+		count += c
+	}
+	return strconv.FormatUint(count, 10)
+}
+
+//处理次数最多的cpu的占比
+func (this *Interrupts) IrqMaxShareFunc(args string) string {
+	irq, err := this.GetIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return FloatToString(irq.MaxShare)
+}
+
+//处理次数最多的cpu编号
+func (this *Interrupts) IrqMaxCpuFunc(args string) string {
+	irq, err := this.GetIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.Itoa(irq.MaxCpu)
+}
+
+//是否不均衡, 1为不均衡
+func (this *Interrupts) IrqImbalancedFunc(args string) string {
+	irq, err := this.GetIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	if irq.Imbalanced {
+		return "1"
+	}
+	return "0"
+}
+
+//设备名
+func (this *Interrupts) IrqDeviceFunc(args string) string {
+	irq, err := this.GetIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return irq.Device
+}
+
+//某中断在某个cpu上平均每秒次数, args为中断名称:cpu编号, 如25:cpu3, 也可传设备名, 如eth0-TxRx-1:3
+func (this *Interrupts) IrqCpuPerSecondFunc(args string) string {
+	pos := strings.LastIndex(args, ":")
+	if pos < 0 {
+		return ""
+	}
+	cpu, err := strconv.Atoi(strings.TrimPrefix(args[pos+1:], "cpu"))
+	if err != nil {
+		return ""
+	}
+	perSecond, err := this.PerSecondByCpu(args[:pos], cpu)
+	if err != nil {
+		return ""
+	}
+	return FloatToString(perSecond)
+}
+
+//某个cpu平均每秒处理的中断次数
+func (this *Interrupts) CpuPerSecondFunc(args string) string {
+	index, err := strconv.Atoi(strings.TrimPrefix(args, "cpu"))
+	if err != nil {
+		return ""
+	}
+	for i, cpu := range this.Cpus {
+		if cpu == index && i < len(this.CpuPerSecond) {
+			return FloatToString(this.CpuPerSecond[i])
+		}
+	}
+	return ""
+}
+
+//不均衡的中断个数
+func (this *Interrupts) ImbalancedNumFunc(args string) string {
+	return strconv.Itoa(len(this.ImbalancedIrqs()))
+}
+
+//不均衡的中断, 如eth0-TxRx-0(cpu2:98.50%)
+func (this *Interrupts) ImbalancedSetFunc(args string) string {
+	ret := []string{}
+	for _, irq := range this.ImbalancedIrqs() {
+		name := irq.Device
+		if name == "" {
+			name = irq.Name
+		}
+		ret = append(ret, fmt.Sprintf("%s(cpu%d:%.2f%%)", name, irq.MaxCpu, irq.MaxShare))
+	}
+	return strings.Join(ret, ",")
+}
+
+func (this *Interrupts) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "irq.avg", Unit: "1/s", Type: GAUGE, Desc: "每秒中断次数", Label: "irq", Args: this.Names, Func: this.IrqPerSecondFunc},
+		{Key: "irq.count", Type: COUNTER, Desc: "中断次数", Label: "irq", Args: this.Names, Func: this.IrqCountFunc},
+		{Key: "irq.max.share", Unit: "%", Type: GAUGE, Desc: "处理次数最多的cpu的占比", Label: "irq", Args: this.Names, Func: this.IrqMaxShareFunc},
+		{Key: "irq.max.cpu", Type: GAUGE, Desc: "处理次数最多的cpu编号", Label: "irq", Args: this.Names, Func: this.IrqMaxCpuFunc},
+		{Key: "irq.imbalanced", Type: GAUGE, Desc: "中断是否集中在一个cpu上", Label: "irq", Args: this.Names, Func: this.IrqImbalancedFunc},
+		{Key: "irq.device", Type: TEXT, Desc: "中断对应的设备", Label: "irq", Args: this.Names, Func: this.IrqDeviceFunc},
+		{Key: "irq.cpu.avg", Unit: "1/s", Type: GAUGE, Desc: "cpu每秒处理的中断次数", Label: "cpu", Args: this.CpuNames, Func: this.CpuPerSecondFunc},
+		{Key: "irq.per.cpu.avg", Unit: "1/s", Type: GAUGE, Desc: "某中断在某个cpu上每秒次数", Label: "irq_cpu", Args: this.IrqCpus, Func: this.IrqCpuPerSecondFunc},
+		{Key: "irq.imbalanced.num", Type: GAUGE, Desc: "不均衡的中断个数", Func: this.ImbalancedNumFunc},
+		{Key: "irq.imbalanced.set", Type: TEXT, Desc: "不均衡的中断", Func: this.ImbalancedSetFunc},
+	}
+}
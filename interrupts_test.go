@@ -0,0 +1,107 @@
+package system
+
+import (
+	"testing"
+)
+
+//依次采集两次快照, 间隔goldenInterval秒
+func collectGoldenInterrupts(t *testing.T, kernel string, imbalanceRate float64) (*Interrupts, *Registry) {
+	irqs := &Interrupts{ProcRoot: goldenProcRoot(kernel, "1"), ImbalanceRate: imbalanceRate}
+	registry := NewRegistry()
+	if err := registry.Register("interrupts", irqs); err != nil {
+		t.Fatal(err)
+	}
+	registry.Collect()
+	for _, irq := range irqs.IrqMap {
+		irq.Last -= goldenInterval
+	}
+	irqs.ProcRoot = goldenProcRoot(kernel, "2")
+	registry.Collect()
+	return irqs, registry
+}
+
+func TestInterrupts(t *testing.T) {
+	//每个内核第一个网卡的中断队列名前缀
+	nics := map[string]string{
+		"kernel-3.10": "eth0",
+		"kernel-4.18": "eth0",
+		"kernel-5.10": "ens5",
+		"kernel-6.8":  "enp1s0",
+	}
+	for _, k := range goldenKernels {
+		t.Run(k.name, func(t *testing.T) {
+			irqs, registry := collectGoldenInterrupts(t, k.name, 0)
+
+			nic := nics[k.name]
+			cases := []struct {
+				name       string
+				device     string
+				perSecond  []float64 //依次为cpu0、其他cpu
+				maxShare   float64
+				imbalanced bool
+			}{
+				{"0", "timer", []float64{100, 100}, 100 / float64(len(irqs.Cpus)), false},
+				{"24", nic + "-TxRx-0", []float64{200, 200}, 100 / float64(len(irqs.Cpus)), false},
+				{"25", nic + "-TxRx-1", []float64{1000, 0}, 100, true},
+				{"LOC", "Local timer interrupts", []float64{250, 250}, 100 / float64(len(irqs.Cpus)), false},
+			}
+			for _, c := range cases {
+				irq, err := irqs.GetIrqByIndex(c.name)
+				if err != nil {
+					t.Fatalf("%s: %v", c.name, err)
+				}
+				if irq.Device != c.device {
+					t.Errorf("%s Device = %s, want %s", c.name, irq.Device, c.device)
+				}
+				for i := range irqs.Cpus {
+					want := c.perSecond[1]
+					if i == 0 {
+						want = c.perSecond[0]
+					}
+					assertFloat(t, c.name+" PerSecond", irq.PerSecond[i], want, 0.001)
+				}
+				assertFloat(t, c.name+" MaxShare", irq.MaxShare, c.maxShare, 0.001)
+				if irq.Imbalanced != c.imbalanced {
+					t.Errorf("%s Imbalanced = %v, want %v", c.name, irq.Imbalanced, c.imbalanced)
+				}
+			}
+
+			values := map[string]string{}
+			for _, sample := range registry.Samples() {
+				if sample.Metric.Key == "irq.per.cpu.avg" {
+					values[sample.Arg] = sample.Value
+				}
+			}
+			if len(values) != len(irqs.IrqNames)*len(irqs.Cpus) {
+				t.Errorf("got %d irq.per.cpu.avg samples, want %d", len(values), len(irqs.IrqNames)*len(irqs.Cpus))
+			}
+			if values["25:cpu0"] != "1000.00" || values["25:cpu1"] != "0" {
+				t.Errorf("irq.per.cpu.avg[25:cpu0] = %s, [25:cpu1] = %s, want 1000.00, 0", values["25:cpu0"], values["25:cpu1"])
+			}
+			for arg, want := range map[string]string{nic + "-TxRx-1:0": "1000.00", "25": "", "25:cpu99": "", "99:cpu0": ""} {
+				if got := irqs.IrqCpuPerSecondFunc(arg); got != want {
+					t.Errorf("IrqCpuPerSecondFunc(%s) = %s, want %s", arg, got, want)
+				}
+			}
+			if got := irqs.ImbalancedSetFunc(""); got != nic+"-TxRx-1(cpu0:100.00%)" {
+				t.Errorf("ImbalancedSetFunc = %s", got)
+			}
+
+			if got := irqs.ImbalancedNumFunc(""); got != "1" {
+				t.Errorf("ImbalancedNumFunc = %s, want 1", got)
+			}
+
+			//ImbalanceRate单位为%, TxRx-1占比100%不超过100, timer等占比100/cpu数超过40
+			rates := map[float64]string{100: "0", 40: "1"}
+			if len(irqs.Cpus) == 2 {
+				rates[40] = "4"
+			}
+			for rate, want := range rates {
+				irqs, _ := collectGoldenInterrupts(t, k.name, rate)
+				if got := irqs.ImbalancedNumFunc(""); got != want {
+					t.Errorf("ImbalancedNumFunc with ImbalanceRate %v = %s, want %s", rate, got, want)
+				}
+			}
+		})
+	}
+}
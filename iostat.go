@@ -61,6 +61,8 @@ type DiskIO struct {
 	ReqRateAvg      float64               //所有分区平均I/O操作百分比
 	MaxReqRate      float64               //磁盘I/O最大使用率
 	MaxReqRateParti string                //磁盘I/O使用率最大的分区名
+	ProcRoot        string                //procfs根目录, 为空时使用ProcRoot
+	Now             func() time.Time      //取当前时间, 为空时使用time.Now
 }
 
 func (this *DiskIO) Collect() error {
@@ -83,11 +85,14 @@ func (this *DiskIO) Dump() {
 
 //读/proc/partitions, 采集分区名称
 func (this *DiskIO) InitPartitions() error {
-	f, err := os.Open("/proc/partitions")
+	f, err := os.Open(ProcPath(this.ProcRoot, "partitions"))
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	if this.PartiMap == nil {
+		this.PartiMap = map[string]*Partition{}
+	}
 	reader := bufio.NewReader(f)
 	row := 0
 	for {
@@ -119,7 +124,7 @@ func (this *DiskIO) InitPartitions() error {
 
 //读/proc/diskstats, 采集io状态
 func (this *DiskIO) InitIoStat() error {
-	f, err := os.Open("/proc/diskstats")
+	f, err := os.Open(ProcPath(this.ProcRoot, "diskstats"))
 	if err != nil {
 		return err
 	}
@@ -157,7 +162,8 @@ func (this *DiskIO) InitIoStat() error {
 			return err
 		}
 		fields := strings.Fields(line)
-		if len(fields) != 14 {
+		//4.18起增加了discard统计(18列), 5.5起增加了flush统计(20列), 只用前14列
+		if len(fields) < 14 {
 			continue
 		}
 		partiName := fields[2]
@@ -176,10 +182,15 @@ func (this *DiskIO) InitIoStat() error {
 		welapsed, _ := strconv.ParseInt(fields[10], 10, 64)
 		elapsed, _ := strconv.ParseInt(fields[12], 10, 64)
 		aveq, _ := strconv.ParseInt(fields[13], 10, 64)
-		now := time.Now().Unix()
-
-		if parti.Last <= 0 {
-			//第一次采集，还没产生时间差，不计算
+		now := currentTime(this.Now).Unix()
+
+		//计数器回绕或重置时与第一次采集一样处理
+		reset := rio < parti.Rio || rmerge < parti.Rmerge || rsect < parti.Rsect || relapsed < parti.Relapsed ||
+			wio < parti.Wio || wmerge < parti.Wmerge || wsect < parti.Wsect || welapsed < parti.Welapsed ||
+			elapsed < parti.Elapsed || aveq < parti.Aveq
+		if parti.Last <= 0 || reset {
+			//第一次采集，还没产生时间差，不计算; 计数器重置时丢弃上个周期的计算结果
+			*parti = Partition{Name: partiName}
 		} else {
 			difftime := float64(now - parti.Last)
 			if difftime > 0 {
@@ -456,6 +467,10 @@ func (this *DiskIO) WsectPerSecondFunc(args string) string {
 func (this *DiskIO) GetKeyByIndex(args string) (string, error) {
 	index, err := strconv.Atoi(args)
 	if err != nil {
+		//也可直接传分区名
+		if _, exists := this.PartiMap[args]; exists {
+			return args, nil
+		}
 		return "", err
 	}
 	if index < 0 {
@@ -468,6 +483,108 @@ func (this *DiskIO) GetKeyByIndex(args string) (string, error) {
 	return this.PartiNames[index], nil
 }
 
+func (this *DiskIO) GetPartiByIndex(args string) (*Partition, error) {
+	key, err := this.GetKeyByIndex(args)
+	if err != nil {
+		return nil, err
+	}
+	parti, exists := this.PartiMap[key]
+	if exists {
+		return parti, nil
+	}
+	return nil, errors.New("key not found")
+}
+
+//磁盘n成功读的次数
+func (this *DiskIO) DiskRioFunc(args string) string {
+	parti, err := this.GetPartiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(parti.Rio, 10)
+}
+
+//磁盘n合并读的次数
+func (this *DiskIO) DiskRmergeFunc(args string) string {
+	parti, err := this.GetPartiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(parti.Rmerge, 10)
+}
+
+//磁盘n成功读扇区的次数
+func (this *DiskIO) DiskRsectFunc(args string) string {
+	parti, err := this.GetPartiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(parti.Rsect, 10)
+}
+
+//磁盘n所有读花费的时间(ms)
+func (this *DiskIO) DiskRelapsedFunc(args string) string {
+	parti, err := this.GetPartiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(parti.Relapsed, 10)
+}
+
+//磁盘n成功写的次数
+func (this *DiskIO) DiskWioFunc(args string) string {
+	parti, err := this.GetPartiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(parti.Wio, 10)
+}
+
+//磁盘n合并写的次数
+func (this *DiskIO) DiskWmergeFunc(args string) string {
+	parti, err := this.GetPartiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(parti.Wmerge, 10)
+}
+
+//磁盘n成功写扇区的次数
+func (this *DiskIO) DiskWsectFunc(args string) string {
+	parti, err := this.GetPartiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(parti.Wsect, 10)
+}
+
+//磁盘n所有写花费的时间(ms)
+func (this *DiskIO) DiskWelapsedFunc(args string) string {
+	parti, err := this.GetPartiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(parti.Welapsed, 10)
+}
+
+//磁盘n I/O操作花费的时间(ms)
+func (this *DiskIO) DiskElapsedFunc(args string) string {
+	parti, err := this.GetPartiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(parti.Elapsed, 10)
+}
+
+//磁盘n I/O操作加权花费的时间(ms)
+func (this *DiskIO) DiskAveqFunc(args string) string {
+	parti, err := this.GetPartiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(parti.Aveq, 10)
+}
+
 //磁盘n平均I/O队列长度
 func (this *DiskIO) DiskQueueSzAvgFunc(args string) string {
 	key, err := this.GetKeyByIndex(args)
@@ -650,3 +767,66 @@ func (this *DiskIO) ReqRateSetFunc(args string) string {
 func (this *DiskIO) MaxUsedRateFunc(args string) string {
 	return FloatToString(this.MaxReqRate) + "," + this.MaxReqRateParti
 }
+
+//所有分区名称
+func (this *DiskIO) Names() []string {
+	return append([]string{}, this.PartiNames...)
+}
+
+func (this *DiskIO) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "disk.io.queue.avg", Type: GAUGE, Desc: "磁盘所有分区平均I/O队列长度", Func: this.QueueSzAvgFunc},
+		{Key: "disk.io.reqsz.avg", Unit: "sector", Type: GAUGE, Desc: "磁盘所有分区平均I/O大小", Func: this.ReqSzAvgFunc},
+		{Key: "disk.io.svctm.avg", Unit: "ms", Type: GAUGE, Desc: "磁盘所有分区平均I/O服务时间", Func: this.ServeAvgFunc},
+		{Key: "disk.io.await.avg", Unit: "ms", Type: GAUGE, Desc: "磁盘所有分区平均I/O等待时间", Func: this.AwaitAvgFunc},
+		{Key: "disk.io.read.kb.avg", Unit: "kb/s", Type: GAUGE, Desc: "磁盘所有分区平均每秒读kb数", Func: this.RkbPerSecondFunc},
+		{Key: "disk.io.write.kb.avg", Unit: "kb/s", Type: GAUGE, Desc: "磁盘所有分区平均每秒写kb数", Func: this.WkbPerSecondFunc},
+		{Key: "disk.io.read.merge.avg", Unit: "1/s", Type: GAUGE, Desc: "磁盘所有分区平均每秒merge读次数", Func: this.RmergePerSecondFunc},
+		{Key: "disk.io.write.merge.avg", Unit: "1/s", Type: GAUGE, Desc: "磁盘所有分区平均每秒merge写次数", Func: this.WmergePerSecondFunc},
+		{Key: "disk.io.read.ops.avg", Unit: "1/s", Type: GAUGE, Desc: "磁盘所有分区平均每秒读次数", Func: this.RioPerSecondFunc},
+		{Key: "disk.io.write.ops.avg", Unit: "1/s", Type: GAUGE, Desc: "磁盘所有分区平均每秒写次数", Func: this.WioPerSecondFunc},
+		{Key: "disk.io.read.sect.avg", Unit: "1/s", Type: GAUGE, Desc: "磁盘所有分区平均每秒读扇区数", Func: this.RsectPerSecondFunc},
+		{Key: "disk.io.write.sect.avg", Unit: "1/s", Type: GAUGE, Desc: "磁盘所有分区平均每秒写扇区数", Func: this.WsectPerSecondFunc},
+		{Key: "disk.io.util.avg", Unit: "%", Type: GAUGE, Desc: "磁盘所有分区平均I/O操作百分比", Func: this.ReqRateAvgFunc},
+		{Key: "disk.io.util.max", Type: TEXT, Desc: "磁盘I/O最大使用率", Func: this.MaxUsedRateFunc},
+
+		{Key: "disk.io.queue", Type: GAUGE, Desc: "分区平均I/O队列长度", Label: "device", Args: this.Names, Func: this.DiskQueueSzAvgFunc},
+		{Key: "disk.io.reqsz", Unit: "sector", Type: GAUGE, Desc: "分区平均I/O大小", Label: "device", Args: this.Names, Func: this.DiskReqSzAvgFunc},
+		{Key: "disk.io.svctm", Unit: "ms", Type: GAUGE, Desc: "分区平均I/O服务时间", Label: "device", Args: this.Names, Func: this.DiskServeAvgFunc},
+		{Key: "disk.io.await", Unit: "ms", Type: GAUGE, Desc: "分区平均I/O等待时间", Label: "device", Args: this.Names, Func: this.DiskAwaitAvgFunc},
+		{Key: "disk.io.read.kb", Unit: "kb/s", Type: GAUGE, Desc: "分区每秒读kb数", Label: "device", Args: this.Names, Func: this.DiskRkbAvgFunc},
+		{Key: "disk.io.write.kb", Unit: "kb/s", Type: GAUGE, Desc: "分区每秒写kb数", Label: "device", Args: this.Names, Func: this.DiskWkbAvgFunc},
+		{Key: "disk.io.read.merge", Unit: "1/s", Type: GAUGE, Desc: "分区每秒merge读次数", Label: "device", Args: this.Names, Func: this.DiskRmergeAvgFunc},
+		{Key: "disk.io.write.merge", Unit: "1/s", Type: GAUGE, Desc: "分区每秒merge写次数", Label: "device", Args: this.Names, Func: this.DiskWmergeAvgFunc},
+		{Key: "disk.io.read.ops", Unit: "1/s", Type: GAUGE, Desc: "分区每秒读完成次数", Label: "device", Args: this.Names, Func: this.DiskRioAvgFunc},
+		{Key: "disk.io.write.ops", Unit: "1/s", Type: GAUGE, Desc: "分区每秒写完成次数", Label: "device", Args: this.Names, Func: this.DiskWioAvgFunc},
+		{Key: "disk.io.read.sect", Unit: "1/s", Type: GAUGE, Desc: "分区每秒读扇区数", Label: "device", Args: this.Names, Func: this.DiskRsectAvgFunc},
+		{Key: "disk.io.write.sect", Unit: "1/s", Type: GAUGE, Desc: "分区每秒写扇区数", Label: "device", Args: this.Names, Func: this.DiskWsectAvgFunc},
+		{Key: "disk.io.util", Unit: "%", Type: GAUGE, Desc: "分区I/O操作百分比", Label: "device", Args: this.Names, Func: this.DiskReqRateAvgFunc},
+
+		{Key: "disk.io.read.ios", Type: COUNTER, Desc: "分区成功读的次数", Label: "device", Args: this.Names, Func: this.DiskRioFunc},
+		{Key: "disk.io.read.merges", Type: COUNTER, Desc: "分区合并读的次数", Label: "device", Args: this.Names, Func: this.DiskRmergeFunc},
+		{Key: "disk.io.read.sectors", Type: COUNTER, Desc: "分区成功读扇区的次数", Label: "device", Args: this.Names, Func: this.DiskRsectFunc},
+		{Key: "disk.io.read.time", Unit: "ms", Type: COUNTER, Desc: "分区所有读花费的时间", Label: "device", Args: this.Names, Func: this.DiskRelapsedFunc},
+		{Key: "disk.io.write.ios", Type: COUNTER, Desc: "分区成功写的次数", Label: "device", Args: this.Names, Func: this.DiskWioFunc},
+		{Key: "disk.io.write.merges", Type: COUNTER, Desc: "分区合并写的次数", Label: "device", Args: this.Names, Func: this.DiskWmergeFunc},
+		{Key: "disk.io.write.sectors", Type: COUNTER, Desc: "分区成功写扇区的次数", Label: "device", Args: this.Names, Func: this.DiskWsectFunc},
+		{Key: "disk.io.write.time", Unit: "ms", Type: COUNTER, Desc: "分区所有写花费的时间", Label: "device", Args: this.Names, Func: this.DiskWelapsedFunc},
+		{Key: "disk.io.time", Unit: "ms", Type: COUNTER, Desc: "分区I/O操作花费的时间", Label: "device", Args: this.Names, Func: this.DiskElapsedFunc},
+		{Key: "disk.io.weighted.time", Unit: "ms", Type: COUNTER, Desc: "分区I/O操作加权花费的时间", Label: "device", Args: this.Names, Func: this.DiskAveqFunc},
+
+		{Key: "disk.io.queue.set", Type: TEXT, Desc: "磁盘各个分区平均I/O队列长度", Func: this.QueueSzSetFunc},
+		{Key: "disk.io.reqsz.set", Type: TEXT, Desc: "磁盘各个分区平均I/O大小", Func: this.ReqSzSetFunc},
+		{Key: "disk.io.svctm.set", Type: TEXT, Desc: "磁盘各个分区平均I/O服务时间", Func: this.ServeSetFunc},
+		{Key: "disk.io.await.set", Type: TEXT, Desc: "磁盘各个分区平均I/O等待时间", Func: this.AwaitSetFunc},
+		{Key: "disk.io.read.kb.set", Type: TEXT, Desc: "磁盘各个分区每秒读kb数", Func: this.RkbPerSecondSetFunc},
+		{Key: "disk.io.write.kb.set", Type: TEXT, Desc: "磁盘各个分区每秒写kb数", Func: this.WkbPerSecondSetFunc},
+		{Key: "disk.io.read.merge.set", Type: TEXT, Desc: "磁盘各个分区每秒merge读次数", Func: this.RmergePerSecondSetFunc},
+		{Key: "disk.io.write.merge.set", Type: TEXT, Desc: "磁盘各个分区每秒merge写次数", Func: this.WmergePerSecondSetFunc},
+		{Key: "disk.io.read.ops.set", Type: TEXT, Desc: "磁盘各个分区每秒读I/O次数", Func: this.RioPerSecondSetFunc},
+		{Key: "disk.io.write.ops.set", Type: TEXT, Desc: "磁盘各个分区每秒写次数", Func: this.WioPerSecondSetFunc},
+		{Key: "disk.io.read.sect.set", Type: TEXT, Desc: "磁盘各个分区平均每秒读扇区数", Func: this.RsectPerSecondSetFunc},
+		{Key: "disk.io.write.sect.set", Type: TEXT, Desc: "磁盘各个分区平均每秒写扇区数", Func: this.WsectPerSecondSetFunc},
+		{Key: "disk.io.util.set", Type: TEXT, Desc: "磁盘各个分区I/O操作百分比", Func: this.ReqRateSetFunc},
+	}
+}
@@ -0,0 +1,311 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+//日志级别, 下标即级别数值
+var KmsgSeverityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+//日志来源, 下标即来源数值, 内核自己写的为kern, 用户态写/dev/kmsg默认为user
+var kmsgFacilityNames = []string{"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}
+
+//日志级别数值
+const (
+	KMSG_EMERG = iota
+	KMSG_ALERT
+	KMSG_CRIT
+	KMSG_ERR
+	KMSG_WARNING
+	KMSG_NOTICE
+	KMSG_INFO
+	KMSG_DEBUG
+)
+
+//内核日志中的一条
+type KmsgRecord struct {
+	Severity  int               //级别, 0(emerg)到7(debug)
+	Facility  int               //来源, 0为kern
+	Seq       uint64            //序号, 单调递增, 日志被覆盖时不连续
+	Timestamp uint64            //从开机到写日志的时间(us), 不含休眠时间
+	Message   string            //日志内容
+	Dict      map[string]string //附加信息, 如SUBSYSTEM=block、DEVICE=b8:1
+}
+
+//级别名称, 如err
+func (this *KmsgRecord) SeverityName() string {
+	if this.Severity < 0 || this.Severity >= len(KmsgSeverityNames) {
+		return strconv.Itoa(this.Severity)
+	}
+	return KmsgSeverityNames[this.Severity]
+}
+
+//来源名称, 如kern
+func (this *KmsgRecord) FacilityName() string {
+	if this.Facility < 0 || this.Facility >= len(kmsgFacilityNames) {
+		return strconv.Itoa(this.Facility)
+	}
+	return kmsgFacilityNames[this.Facility]
+}
+
+//读/dev/kmsg, 按序号只处理上次读取之后的日志, 统计一个周期每个级别的日志条数;
+//读/dev/kmsg需要root权限或kernel.dmesg_restrict为0, 没有权限时Available为false, 不上报;
+//OOM、Machine可共用同一个Kmsg, 一个周期只读一次, 此时Kmsg需要先于它们采集
+type Kmsg struct {
+	Records        []*KmsgRecord     //一个周期新增的日志, 第一次采集时缓冲区中已有的日志不算新增
+	SeverityCounts map[string]uint64 //级别名称=>一个周期新增的日志条数
+	LastSeq        uint64            //上次读到的最大序号
+	Available      bool              //是否能读内核日志
+	Path           string            //内核日志, 为空时读/dev/kmsg, 也可指向同样格式的文件
+
+	all      []*KmsgRecord //本周期读到的日志: 第一次采集时为缓冲区中已有的全部日志, 之后与Records相同, 跨周期的上下文由使用方保存
+	read     bool          //是否已采集过
+	seqValid bool          //LastSeq是否有效
+}
+
+func (this *Kmsg) Dump() {
+	fmt.Printf("available:%v ", this.Available)
+	for _, name := range KmsgSeverityNames {
+		fmt.Printf("%s:%d ", name, this.SeverityCounts[name])
+	}
+	fmt.Println()
+	for _, record := range this.Records {
+		fmt.Printf("[%d.%06d] %s.%s seq:%d %s\n",
+			record.Timestamp/1000000,
+			record.Timestamp%1000000,
+			record.FacilityName(),
+			record.SeverityName(),
+			record.Seq,
+			record.Message)
+	}
+}
+
+func (this *Kmsg) Collect() error {
+	counts := map[string]uint64{}
+	for _, name := range KmsgSeverityNames {
+		counts[name] = 0
+	}
+	this.Records = []*KmsgRecord{}
+	this.SeverityCounts = counts
+	this.all = []*KmsgRecord{}
+	records, err := this.ReadNew()
+	this.Available = err == nil
+	if err != nil {
+		//没有权限或内核不支持/dev/kmsg时不算错误
+		if os.IsPermission(err) || os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	this.all = records
+	if !this.read {
+		records = []*KmsgRecord{}
+	}
+	for _, record := range records {
+		counts[record.SeverityName()]++
+	}
+	this.Records = records
+	this.read = true
+	return nil
+}
+
+//一个周期err及以上级别新增的日志条数
+func (this *Kmsg) ErrCount() uint64 {
+	var count uint64
+	for _, name := range KmsgSeverityNames[:KMSG_ERR+1] {
+		count += this.SeverityCounts[name]
+	}
+	return count
+}
+
+//读缓冲区中的所有日志, 不影响LastSeq
+func (this *Kmsg) ReadAll() ([]*KmsgRecord, error) {
+	if this.Path != "" {
+		content, err := GetFileContent(this.Path)
+		if err != nil {
+			return nil, err
+		}
+		records := []*KmsgRecord{}
+		for _, line := range strings.Split(content, "\n") {
+			if strings.HasPrefix(line, " ") {
+				//以空格开头的行为上一条的附加信息
+				if len(records) > 0 {
+					parseKmsgDict(records[len(records)-1], line)
+				}
+				continue
+			}
+			if record := ParseKmsgRecord(line); record != nil {
+				records = append(records, record)
+			}
+		}
+		return records, nil
+	}
+	//非阻塞读, 读完返回EAGAIN; 不使用os.File, 避免被runtime poller挂起
+	fd, err := syscall.Open("/dev/kmsg", syscall.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	records := []*KmsgRecord{}
+	buf := make([]byte, 8192)
+	for {
+		//每次read返回一条日志: 优先级,序号,时间戳,标志;内容\n, 之后以空格开头的行为附加信息
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EAGAIN {
+			break
+		}
+		if err == syscall.EPIPE || err == syscall.EINTR {
+			//日志在读取前已被覆盖, 继续读下一条
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			break
+		}
+		if record := ParseKmsgRecord(string(buf[:n])); record != nil {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+//读上次读取之后的日志, 第一次读时返回缓冲区中的所有日志
+func (this *Kmsg) ReadNew() ([]*KmsgRecord, error) {
+	records, err := this.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	//重启或换成了另一个文件, 序号变小, 从头开始
+	if len(records) > 0 && records[len(records)-1].Seq < this.LastSeq {
+		this.seqValid = false
+	}
+	ret := []*KmsgRecord{}
+	for _, record := range records {
+		if !this.seqValid || record.Seq > this.LastSeq {
+			ret = append(ret, record)
+		}
+	}
+	if len(records) > 0 {
+		this.LastSeq = records[len(records)-1].Seq
+		this.seqValid = true
+	}
+	return ret, nil
+}
+
+//解析优先级,序号,时间戳,标志[,...];内容, 之后以空格开头的行为附加信息, 格式错误时返回nil
+func ParseKmsgRecord(str string) *KmsgRecord {
+	pos := strings.Index(str, ";")
+	if pos < 0 || strings.HasPrefix(str, " ") {
+		return nil
+	}
+	fields := strings.Split(str[:pos], ",")
+	if len(fields) < 3 {
+		return nil
+	}
+	priority, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil
+	}
+	seq, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil
+	}
+	timestamp, _ := strconv.ParseUint(fields[2], 10, 64)
+	record := &KmsgRecord{
+		Severity:  priority & 7,
+		Facility:  priority >> 3,
+		Seq:       seq,
+		Timestamp: timestamp,
+	}
+	lines := strings.Split(str[pos+1:], "\n")
+	record.Message = lines[0]
+	for _, line := range lines[1:] {
+		parseKmsgDict(record, line)
+	}
+	return record
+}
+
+//解析 SUBSYSTEM=block这样的附加信息
+func parseKmsgDict(record *KmsgRecord, line string) {
+	line = strings.TrimPrefix(line, " ")
+	pos := strings.Index(line, "=")
+	if pos <= 0 {
+		return
+	}
+	if record.Dict == nil {
+		record.Dict = map[string]string{}
+	}
+	record.Dict[line[:pos]] = line[pos+1:]
+}
+
+//级别名称或数值转为级别数值
+func kmsgSeverity(args string) (int, error) {
+	for i, name := range KmsgSeverityNames {
+		if name == args {
+			return i, nil
+		}
+	}
+	severity, err := strconv.Atoi(args)
+	if err != nil || severity < 0 || severity >= len(KmsgSeverityNames) {
+		return 0, errors.New("invalid severity: " + args)
+	}
+	return severity, nil
+}
+
+//所有级别名称
+func (this *Kmsg) Severities() []string {
+	return append([]string{}, KmsgSeverityNames...)
+}
+
+//一个周期某级别新增的日志条数, 可传级别名称或数值
+func (this *Kmsg) SeverityCountFunc(args string) string {
+	severity, err := kmsgSeverity(args)
+	if err != nil || !this.Available {
+		return ""
+	}
+	return strconv.FormatUint(this.SeverityCounts[KmsgSeverityNames[severity]], 10)
+}
+
+//一个周期err及以上级别新增的日志条数
+func (this *Kmsg) ErrCountFunc(args string) string {
+	if !this.Available {
+		return ""
+	}
+	return strconv.FormatUint(this.ErrCount(), 10)
+}
+
+//一个周期包含某关键字的新增日志条数
+func (this *Kmsg) KeywordCountFunc(args string) string {
+	if !this.Available {
+		return ""
+	}
+	return strconv.Itoa(kmsgKeywordCount(this.Records, args))
+}
+
+//包含关键字的日志条数
+func kmsgKeywordCount(records []*KmsgRecord, keyword string) int {
+	count := 0
+	for _, record := range records {
+		if strings.Contains(record.Message, keyword) {
+			count++
+		}
+	}
+	return count
+}
+
+func (this *Kmsg) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "kmsg.count", Type: GAUGE, Desc: "一个周期新增的内核日志条数", Label: "severity", Args: this.Severities, Func: this.SeverityCountFunc},
+		{Key: "kmsg.err.count", Type: GAUGE, Desc: "一个周期新增的err及以上级别内核日志条数", Func: this.ErrCountFunc},
+		{Key: "kmsg.keyword.count", Type: GAUGE, Desc: "一个周期包含某关键字的新增内核日志条数", Label: "keyword", Func: this.KeywordCountFunc},
+	}
+}
@@ -0,0 +1,106 @@
+package system
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func goldenKmsgPath(kernel string, snapshot string) string {
+	return filepath.Join("testdata", kernel, snapshot, "kmsg")
+}
+
+func TestKmsgCollect(t *testing.T) {
+	k := &Kmsg{Path: goldenKmsgPath("kernel-6.8", "1")}
+	if err := k.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	//第一次采集时缓冲区中已有的日志不算新增
+	if !k.Available || len(k.Records) != 0 || k.ErrCountFunc("") != "0" {
+		t.Errorf("first collect: available %v, %d records, err count %s", k.Available, len(k.Records), k.ErrCountFunc(""))
+	}
+
+	k.Path = goldenKmsgPath("kernel-6.8", "2")
+	if err := k.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"err": "2", "warning": "1", "info": "2", "debug": "0"}
+	for severity, count := range want {
+		if got := k.SeverityCountFunc(severity); got != count {
+			t.Errorf("%s count = %s, want %s", severity, got, count)
+		}
+	}
+	if got := k.ErrCountFunc(""); got != "2" {
+		t.Errorf("err count = %s, want 2", got)
+	}
+}
+
+func TestKmsgUnavailable(t *testing.T) {
+	k := &Kmsg{Path: filepath.Join("testdata", "nonexistent", "kmsg")}
+	if err := k.Collect(); err != nil {
+		t.Fatalf("Collect returned %v, want nil", err)
+	}
+	if k.Available {
+		t.Error("Available = true, want false")
+	}
+	for _, m := range k.Metrics() {
+		if value := m.Func("err"); value != "" {
+			t.Errorf("%s = %s, want empty", m.Key, value)
+		}
+	}
+}
+
+//kmsg、oom、machine共用一个Kmsg, 一个周期只读一次内核日志
+func TestKmsgShared(t *testing.T) {
+	kmsg := &Kmsg{Path: goldenKmsgPath("kernel-6.8", "1")}
+	oom := &OOM{Kmsg: kmsg, ProcRoot: goldenProcRoot("kernel-6.8", "1")}
+	machine := &Machine{Kmsg: kmsg}
+	registry := NewRegistry()
+	for _, c := range []struct {
+		name      string
+		collector Collector
+	}{
+		{"kmsg", kmsg},
+		{"oom", oom},
+		{"machine", machine},
+	} {
+		if err := registry.Register(c.name, c.collector); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry.Collect()
+	if value, _ := registry.Get("machine.dmesg.error", ""); value != "0" {
+		t.Errorf("first machine.dmesg.error = %s, want 0", value)
+	}
+	if len(oom.Events) != 0 || oom.LastEvent == nil || oom.LastEvent.Pid != 4321 {
+		t.Errorf("first collect: %d events, last event %v", len(oom.Events), oom.LastEvent)
+	}
+
+	kmsg.Path = goldenKmsgPath("kernel-6.8", "2")
+	oom.ProcRoot = goldenProcRoot("kernel-6.8", "2")
+	registry.Collect()
+	if value, _ := registry.Get("machine.dmesg.error", ""); value != "2" {
+		t.Errorf("machine.dmesg.error = %s, want 2", value)
+	}
+	//多次取值不影响结果
+	if value, _ := registry.Get("machine.dmesg.error", ""); value != "2" {
+		t.Errorf("machine.dmesg.error = %s, want 2", value)
+	}
+	if len(oom.Events) != 1 || oom.Events[0].Pid != 5555 || oom.Events[0].Name != "python3" {
+		t.Fatalf("unexpected events %v", oom.Events)
+	}
+	if !oom.LogAvailable || oom.LastEvent != oom.Events[0] {
+		t.Errorf("LogAvailable %v, last event %v", oom.LogAvailable, oom.LastEvent)
+	}
+}
+
+//DmesgErrCount与dmesg|grep error|wc -l一致, 按关键字而不是级别统计
+func TestKmsgKeywordCount(t *testing.T) {
+	records, err := (&Kmsg{Path: goldenKmsgPath("kernel-6.8", "2")}).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := kmsgKeywordCount(records, "error"); got != 1 {
+		t.Errorf("kmsgKeywordCount(error) = %d, want 1", got)
+	}
+}
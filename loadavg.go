@@ -1,13 +1,151 @@
 package system
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 //一分钟平均负载
 func LoadAvg1(args string) string {
-	content, err := GetFileContent("/proc/loadavg")
+	content, err := GetFileContent(ProcPath("", "loadavg"))
 	if err != nil {
 		return ""
 	}
 	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return ""
+	}
 	return fields[0]
 }
+
+//读/proc/loadavg, 采集1、5、15分钟平均负载及调度实体数
+type Load struct {
+	Load1        float64 //一分钟平均负载
+	Load5        float64 //五分钟平均负载
+	Load15       float64 //十五分钟平均负载
+	Runnable     uint64  //当前可运行的调度实体(进程、线程)数
+	Entities     uint64  //调度实体总数
+	LastPid      uint64  //最近创建的进程id
+	CpuNum       int     //逻辑cpu个数, 取/proc/stat中cpuN的行数
+	Load1PerCpu  float64 //每个逻辑cpu的一分钟平均负载, 不同核数的机器可使用同一阈值
+	Load5PerCpu  float64 //每个逻辑cpu的五分钟平均负载
+	Load15PerCpu float64 //每个逻辑cpu的十五分钟平均负载
+	ProcRoot     string  //procfs根目录, 为空时使用ProcRoot
+}
+
+func (this *Load) Dump() {
+	fmt.Printf("Load1:%.2f, Load5:%.2f, Load15:%.2f, Runnable:%d, Entities:%d, LastPid:%d, CpuNum:%d, Load1PerCpu:%f\n",
+		this.Load1,
+		this.Load5,
+		this.Load15,
+		this.Runnable,
+		this.Entities,
+		this.LastPid,
+		this.CpuNum,
+		this.Load1PerCpu)
+}
+
+func (this *Load) Collect() error {
+	content, err := GetFileContent(ProcPath(this.ProcRoot, "loadavg"))
+	if err != nil {
+		return err
+	}
+	//如0.52 0.58 0.59 2/612 12345
+	fields := strings.Fields(content)
+	if len(fields) < 5 {
+		return errors.New("invalid loadavg: " + content)
+	}
+	entities := strings.SplitN(fields[3], "/", 2)
+	if len(entities) != 2 {
+		return errors.New("invalid loadavg: " + content)
+	}
+	load1, err1 := strconv.ParseFloat(fields[0], 64)
+	load5, err5 := strconv.ParseFloat(fields[1], 64)
+	load15, err15 := strconv.ParseFloat(fields[2], 64)
+	if err1 != nil || err5 != nil || err15 != nil {
+		return errors.New("invalid loadavg: " + content)
+	}
+	this.Load1, this.Load5, this.Load15 = load1, load5, load15
+	this.Runnable, _ = strconv.ParseUint(entities[0], 10, 64)
+	this.Entities, _ = strconv.ParseUint(entities[1], 10, 64)
+	this.LastPid, _ = strconv.ParseUint(fields[4], 10, 64)
+
+	stat, err := GetFileContent(ProcPath(this.ProcRoot, "stat"))
+	if err != nil {
+		return err
+	}
+	this.CpuNum = 0
+	for _, line := range strings.Split(stat, "\n") {
+		if strings.HasPrefix(line, "cpu") && !strings.HasPrefix(line, "cpu ") {
+			this.CpuNum++
+		}
+	}
+	this.Load1PerCpu, this.Load5PerCpu, this.Load15PerCpu = 0, 0, 0
+	if this.CpuNum > 0 {
+		this.Load1PerCpu = load1 / float64(this.CpuNum)
+		this.Load5PerCpu = load5 / float64(this.CpuNum)
+		this.Load15PerCpu = load15 / float64(this.CpuNum)
+	}
+	return nil
+}
+
+//一分钟平均负载
+func (this *Load) Load1Func(args string) string {
+	return FloatToString(this.Load1)
+}
+
+//五分钟平均负载
+func (this *Load) Load5Func(args string) string {
+	return FloatToString(this.Load5)
+}
+
+//十五分钟平均负载
+func (this *Load) Load15Func(args string) string {
+	return FloatToString(this.Load15)
+}
+
+//每个逻辑cpu的一分钟平均负载
+func (this *Load) Load1PerCpuFunc(args string) string {
+	return FloatToString(this.Load1PerCpu)
+}
+
+//每个逻辑cpu的五分钟平均负载
+func (this *Load) Load5PerCpuFunc(args string) string {
+	return FloatToString(this.Load5PerCpu)
+}
+
+//每个逻辑cpu的十五分钟平均负载
+func (this *Load) Load15PerCpuFunc(args string) string {
+	return FloatToString(this.Load15PerCpu)
+}
+
+//当前可运行的调度实体数
+func (this *Load) RunnableFunc(args string) string {
+	return strconv.FormatUint(this.Runnable, 10)
+}
+
+//调度实体总数
+func (this *Load) EntitiesFunc(args string) string {
+	return strconv.FormatUint(this.Entities, 10)
+}
+
+//最近创建的进程id
+func (this *Load) LastPidFunc(args string) string {
+	return strconv.FormatUint(this.LastPid, 10)
+}
+
+func (this *Load) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "load.1min", Type: GAUGE, Desc: "一分钟平均负载", Func: this.Load1Func},
+		{Key: "load.5min", Type: GAUGE, Desc: "五分钟平均负载", Func: this.Load5Func},
+		{Key: "load.15min", Type: GAUGE, Desc: "十五分钟平均负载", Func: this.Load15Func},
+		{Key: "load.1min.per.cpu", Type: GAUGE, Desc: "每个逻辑cpu的一分钟平均负载", Func: this.Load1PerCpuFunc},
+		{Key: "load.5min.per.cpu", Type: GAUGE, Desc: "每个逻辑cpu的五分钟平均负载", Func: this.Load5PerCpuFunc},
+		{Key: "load.15min.per.cpu", Type: GAUGE, Desc: "每个逻辑cpu的十五分钟平均负载", Func: this.Load15PerCpuFunc},
+		{Key: "load.runnable", Type: GAUGE, Desc: "可运行的调度实体数", Func: this.RunnableFunc},
+		{Key: "load.entities", Type: GAUGE, Desc: "调度实体总数", Func: this.EntitiesFunc},
+		{Key: "load.last.pid", Type: GAUGE, Desc: "最近创建的进程id", Func: this.LastPidFunc},
+	}
+}
@@ -0,0 +1,38 @@
+package system
+
+import (
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		kernel string
+		cpuNum int
+		perCpu string //每cpu一分钟负载
+	}{
+		{"kernel-3.10", 2, "0.60"},
+		{"kernel-4.18", 4, "0.30"},
+		{"kernel-5.10", 4, "0.30"},
+		{"kernel-6.8", 8, "0.15"},
+	}
+	for _, c := range cases {
+		t.Run(c.kernel, func(t *testing.T) {
+			load := &Load{ProcRoot: goldenProcRoot(c.kernel, "2")}
+			if err := load.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{load.Load1Func(""), load.Load5Func(""), load.Load15Func(""), load.RunnableFunc(""), load.EntitiesFunc(""), load.LastPidFunc("")}
+			if got[0] != "1.20" || got[1] != "0.71" || got[2] != "0.63" || got[3] != "3" || got[4] != "615" || got[5] != "12410" {
+				t.Errorf("got %v, want [1.20 0.71 0.63 3 615 12410]", got)
+			}
+			if load.CpuNum != c.cpuNum {
+				t.Errorf("CpuNum = %d, want %d", load.CpuNum, c.cpuNum)
+			}
+			if got := load.Load1PerCpuFunc(""); got != c.perCpu {
+				t.Errorf("Load1PerCpuFunc = %s, want %s", got, c.perCpu)
+			}
+			assertFloat(t, "Load5PerCpu", load.Load5PerCpu, 0.71/float64(c.cpuNum), 0.000001)
+			assertFloat(t, "Load15PerCpu", load.Load15PerCpu, 0.63/float64(c.cpuNum), 0.000001)
+		})
+	}
+}
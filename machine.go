@@ -7,36 +7,40 @@ import (
 )
 
 //机型
+//与dmidecode的Product Name一致, 依次为System Information、Base Board Information, 相邻重复的只保留一个
 func MachineProductName(args string) string {
-	cmd := "dmidecode | grep 'Product Name' | uniq 2>/dev/null"
-	output, err := Exec(cmd)
-	if err != nil {
-		return ""
-	}
-	if output == "" {
-		return ""
-	}
-	lines := strings.Split(output, "\n")
 	models := []string{}
-	for _, line := range lines {
-		if strings.Contains(line, "Product Name:") {
-			model := strings.Replace(line, "Product Name:", "", -1)
-			model = strings.TrimSpace(model)
-			models = append(models, model)
+	for _, name := range []string{"product_name", "board_name"} {
+		model, err := GetFileContent(SysPath("", "class", "dmi", "id", name))
+		if err != nil {
+			continue
+		}
+		model = strings.TrimSpace(model)
+		if len(models) > 0 && models[len(models)-1] == model {
+			continue
 		}
+		models = append(models, model)
 	}
 	ret := strings.Join(models, "|")
 	return ret
 }
 
-//操作系统版本
+//操作系统版本, 与uname -sr一致
 func OsVersion(args string) string {
-	return ExecOutput("uname -sr")
+	osType, err := GetFileContent(ProcPath("", "sys", "kernel", "ostype"))
+	if err != nil {
+		return ""
+	}
+	osRelease, err := GetFileContent(ProcPath("", "sys", "kernel", "osrelease"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(osType) + " " + strings.TrimSpace(osRelease)
 }
 
 //已运行时间(天)
 func UpTime(args string) string {
-	content, err := GetFileContent("/proc/uptime")
+	content, err := GetFileContent(ProcPath("", "uptime"))
 	if err != nil {
 		return ""
 	}
@@ -48,3 +52,57 @@ func UpTime(args string) string {
 	days := upSeconds / 3600 / 24
 	return fmt.Sprintf("%.0f", days)
 }
+
+//主机信息及不属于其他采集器的指标, 除machine.dmesg.error外取值时实时读取
+type Machine struct {
+	Kmsg *Kmsg //共用的内核日志, 需要先于Machine采集, 为空时自己读/dev/kmsg
+
+	kmsg *Kmsg //没有共用的Kmsg时自己读
+}
+
+func (this *Machine) Collect() error {
+	if this.Kmsg == nil {
+		if this.kmsg == nil {
+			this.kmsg = &Kmsg{}
+		}
+		return this.kmsg.Collect()
+	}
+	return nil
+}
+
+//一个周期内核日志新增的err及以上级别日志条数, 第一次采集时为0, 不能读内核日志时返回空
+func (this *Machine) DmesgErrCountFunc(args string) string {
+	kmsg := this.Kmsg
+	if kmsg == nil {
+		kmsg = this.kmsg
+	}
+	if kmsg == nil {
+		return ""
+	}
+	return kmsg.ErrCountFunc(args)
+}
+
+func (this *Machine) Dump() {
+	fmt.Printf("ProductName:%s, OsVersion:%s, UpTime:%s, CpuModel:%s, CpuNum:%s, LoadAvg1:%s\n",
+		MachineProductName(""),
+		OsVersion(""),
+		UpTime(""),
+		CpuModel(""),
+		CpuNum(""),
+		LoadAvg1(""))
+}
+
+func (this *Machine) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "machine.product", Type: TEXT, Desc: "机型", Func: MachineProductName},
+		{Key: "machine.os.version", Type: TEXT, Desc: "操作系统版本", Func: OsVersion},
+		{Key: "machine.uptime", Unit: "day", Type: GAUGE, Desc: "已运行时间", Func: UpTime},
+		{Key: "machine.cpu.model", Type: TEXT, Desc: "CPU型号", Func: CpuModel},
+		{Key: "machine.cpu.num", Type: GAUGE, Desc: "逻辑CPU个数", Func: CpuNum},
+		{Key: "machine.load.1min", Type: GAUGE, Desc: "一分钟平均负载", Func: LoadAvg1},
+		{Key: "machine.dmesg.error", Type: GAUGE, Desc: "一个周期内核日志新增err及以上级别日志条数", Func: this.DmesgErrCountFunc},
+		{Key: "proc.num", Type: GAUGE, Desc: "进程数", Label: "keyword", Func: ProcNumByKeyword},
+		{Key: "proc.cpu.rate", Unit: "%", Type: GAUGE, Desc: "进程cpu使用率", Label: "proc", Func: CpuUsedRateByProc},
+		{Key: "proc.mem.rate", Unit: "%", Type: GAUGE, Desc: "进程内存使用率", Label: "proc", Func: MemUsedRateByProc},
+	}
+}
@@ -3,6 +3,7 @@ package system
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,45 +12,80 @@ import (
 )
 
 type Mem struct {
-	Buffers      uint64
-	Cached       uint64
-	MemTotal     uint64
-	MemFree      uint64
-	MemUsed      uint64
-	MemUsedRate  float64 //物理内存使用率
-	SwapTotal    uint64
-	SwapUsed     uint64
-	SwapUsedRate float64 //交换内存使用率
-	SwapFree     uint64
-}
-
-var WANT = map[string]struct{}{
-	"Buffers:":   struct{}{},
-	"Cached:":    struct{}{},
-	"MemTotal:":  struct{}{},
-	"MemFree:":   struct{}{},
-	"SwapTotal:": struct{}{},
-	"SwapFree:":  struct{}{},
+	Buffers        uint64
+	Cached         uint64
+	MemTotal       uint64
+	MemFree        uint64 //可用内存, 有MemAvailable时取MemAvailable, 否则为MemFree+Buffers+Cached
+	MemAvailable   uint64 //内核估算的可用内存, 3.14以前的内核没有, 此时同MemFree
+	MemUsed        uint64
+	MemUsedRate    float64 //物理内存使用率
+	SwapTotal      uint64
+	SwapUsed       uint64
+	SwapUsedRate   float64 //交换内存使用率
+	SwapFree       uint64
+	Shmem          uint64            //共享内存及tmpfs, 包含在Cached中但不能回收
+	Slab           uint64            //内核slab
+	SReclaimable   uint64            //可回收的slab, 如dentry、inode缓存
+	SUnreclaim     uint64            //不可回收的slab
+	Dirty          uint64            //等待写回磁盘的脏页
+	Writeback      uint64            //正在写回磁盘的页
+	AnonPages      uint64            //匿名页
+	Mapped         uint64            //mmap映射的文件页
+	CommittedAS    uint64            //已申请的虚拟内存, 即Committed_AS
+	CommitLimit    uint64            //overcommit_memory为2时可申请的虚拟内存上限
+	PageTables     uint64            //页表
+	KernelStack    uint64            //内核栈
+	HugePagesTotal uint64            //默认大小的大页总数
+	HugePagesFree  uint64            //未分配的大页数
+	HugePagesRsvd  uint64            //已承诺分配但还未使用的大页数
+	HugePagesSurp  uint64            //超过nr_hugepages临时分配的大页数
+	Hugepagesize   uint64            //默认大页大小(kb)
+	MemInfo        map[string]uint64 //meminfo所有字段, 名称不带冒号, 除HugePages_*外单位为kb
+	MemInfoKeys    []string          //meminfo所有字段名称, 与文件中顺序一致
+	ProcRoot       string            //procfs根目录, 为空时使用ProcRoot
 }
 
 func (this *Mem) Dump() {
-	fmt.Printf("Buffers:%d, Cached:%d, MemTotal:%d, MemFree:%d, SwapTotal:%d, SwapUsed:%d, SwapFree:%d (kb)",
+	fmt.Printf("Buffers:%d, Cached:%d, MemTotal:%d, MemFree:%d, MemAvailable:%d, SwapTotal:%d, SwapUsed:%d, SwapFree:%d, "+
+		"Shmem:%d, Slab:%d, SReclaimable:%d, SUnreclaim:%d, Dirty:%d, Writeback:%d, AnonPages:%d, Mapped:%d, "+
+		"CommittedAS:%d, CommitLimit:%d, PageTables:%d, KernelStack:%d, Hugepagesize:%d (kb), "+
+		"HugePagesTotal:%d, HugePagesFree:%d, HugePagesRsvd:%d, HugePagesSurp:%d",
 		this.Buffers,
 		this.Cached,
 		this.MemTotal,
 		this.MemFree,
+		this.MemAvailable,
 		this.SwapTotal,
 		this.SwapUsed,
-		this.SwapFree)
+		this.SwapFree,
+		this.Shmem,
+		this.Slab,
+		this.SReclaimable,
+		this.SUnreclaim,
+		this.Dirty,
+		this.Writeback,
+		this.AnonPages,
+		this.Mapped,
+		this.CommittedAS,
+		this.CommitLimit,
+		this.PageTables,
+		this.KernelStack,
+		this.Hugepagesize,
+		this.HugePagesTotal,
+		this.HugePagesFree,
+		this.HugePagesRsvd,
+		this.HugePagesSurp)
 }
 
 func (this *Mem) Collect() error {
-	contents, err := ioutil.ReadFile("/proc/meminfo")
+	contents, err := ioutil.ReadFile(ProcPath(this.ProcRoot, "meminfo"))
 	if err != nil {
 		return err
 	}
 	reader := bufio.NewReader(bytes.NewBuffer(contents))
 
+	memInfo := map[string]uint64{}
+	keys := []string{}
 	for {
 		line, err := reader.ReadString('\n')
 		if err == io.EOF {
@@ -58,43 +94,100 @@ func (this *Mem) Collect() error {
 			return err
 		}
 		fields := strings.Fields(string(line))
-		fieldName := fields[0]
-
-		_, ok := WANT[fieldName]
-		if ok && len(fields) == 3 {
-			val, numerr := strconv.ParseUint(fields[1], 10, 64)
-			if numerr != nil {
-				continue
-			}
-			switch fieldName {
-			case "Buffers:":
-				this.Buffers = val
-			case "Cached:":
-				this.Cached = val
-			case "MemTotal:":
-				this.MemTotal = val
-			case "MemFree:":
-				this.MemFree = val
-			case "SwapTotal:":
-				this.SwapTotal = val
-			case "SwapFree:":
-				this.SwapFree = val
-			}
+		//HugePages_Total等没有单位, 只有两列
+		if len(fields) < 2 || !strings.HasSuffix(fields[0], ":") {
+			continue
 		}
+		val, numerr := strconv.ParseUint(fields[1], 10, 64)
+		if numerr != nil {
+			continue
+		}
+		key := strings.TrimSuffix(fields[0], ":")
+		if _, exists := memInfo[key]; !exists {
+			keys = append(keys, key)
+		}
+		memInfo[key] = val
 	}
+	this.MemInfo = memInfo
+	this.MemInfoKeys = keys
+
+	this.Buffers = memInfo["Buffers"]
+	this.Cached = memInfo["Cached"]
+	this.MemTotal = memInfo["MemTotal"]
+	this.SwapTotal = memInfo["SwapTotal"]
+	this.SwapFree = memInfo["SwapFree"]
+	this.Shmem = memInfo["Shmem"]
+	this.Slab = memInfo["Slab"]
+	this.SReclaimable = memInfo["SReclaimable"]
+	this.SUnreclaim = memInfo["SUnreclaim"]
+	this.Dirty = memInfo["Dirty"]
+	this.Writeback = memInfo["Writeback"]
+	this.AnonPages = memInfo["AnonPages"]
+	this.Mapped = memInfo["Mapped"]
+	this.CommittedAS = memInfo["Committed_AS"]
+	this.CommitLimit = memInfo["CommitLimit"]
+	this.PageTables = memInfo["PageTables"]
+	this.KernelStack = memInfo["KernelStack"]
+	this.HugePagesTotal = memInfo["HugePages_Total"]
+	this.HugePagesFree = memInfo["HugePages_Free"]
+	this.HugePagesRsvd = memInfo["HugePages_Rsvd"]
+	this.HugePagesSurp = memInfo["HugePages_Surp"]
+	this.Hugepagesize = memInfo["Hugepagesize"]
+
 	this.SwapUsed = this.SwapTotal - this.SwapFree
-	//free + buffer + cached 才是可实际使用的内存
-	this.MemFree = this.MemFree + this.Buffers + this.Cached
+	if available, exists := memInfo["MemAvailable"]; exists {
+		//Cached中的shmem、tmpfs不能回收, MemAvailable更准确
+		this.MemAvailable = available
+	} else {
+		//老内核没有MemAvailable, free + buffer + cached 近似为可实际使用的内存
+		this.MemAvailable = memInfo["MemFree"] + this.Buffers + this.Cached
+	}
+	if this.MemAvailable > this.MemTotal {
+		this.MemAvailable = this.MemTotal
+	}
+	this.MemFree = this.MemAvailable
 	this.MemUsed = this.MemTotal - this.MemFree
+	this.MemUsedRate = 0
 	if this.MemTotal > 0 {
 		this.MemUsedRate = float64(this.MemUsed) / float64(this.MemTotal) * 100
 	}
+	this.SwapUsedRate = 0
 	if this.SwapTotal > 0 {
 		this.SwapUsedRate = float64(this.SwapUsed) / float64(this.SwapTotal) * 100
 	}
 	return nil
 }
 
+//按名称取meminfo中任意字段, 名称可带冒号, 如Active(file)、HugePages_Total
+func (this *Mem) GetMemInfo(key string) (uint64, error) {
+	val, exists := this.MemInfo[strings.TrimSuffix(key, ":")]
+	if !exists {
+		return 0, errors.New("meminfo key not found")
+	}
+	return val, nil
+}
+
+//meminfo所有字段名称
+func (this *Mem) Keys() []string {
+	return append([]string{}, this.MemInfoKeys...)
+}
+
+//meminfo中任意字段, 内核没有该字段时返回空
+func (this *Mem) MemInfoFunc(args string) string {
+	val, err := this.GetMemInfo(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatUint(val, 10)
+}
+
+//meminfo中某个字段, 内核没有该字段时返回空
+func (this *Mem) memInfoFunc(key string) MetricFunc {
+	return func(args string) string {
+		return this.MemInfoFunc(key)
+	}
+}
+
 //总内存大小(GB, 保留2位小数)
 func (this *Mem) MemTotalGB(args string) string {
 	memTotal := float64(this.MemTotal)
@@ -121,6 +214,11 @@ func (this *Mem) MemUsedFunc(args string) string {
 	return strconv.FormatUint(this.MemUsed, 10)
 }
 
+//可用物理内存(kb)
+func (this *Mem) MemAvailableFunc(args string) string {
+	return strconv.FormatUint(this.MemAvailable, 10)
+}
+
 //剩余物理内存(kb)
 func (this *Mem) MemFreeFunc(args string) string {
 	return strconv.FormatUint(this.MemFree, 10)
@@ -151,7 +249,56 @@ func (this *Mem) SwapUsedRateFunc(args string) string {
 	return FloatToString(this.SwapUsedRate)
 }
 
-//返回某进程的内存使用率
+func (this *Mem) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "mem.total.gb", Unit: "GB", Type: GAUGE, Desc: "总内存大小", Func: this.MemTotalGB},
+		{Key: "mem.total", Unit: "kb", Type: GAUGE, Desc: "总内存大小", Func: this.MemTotalFunc},
+		{Key: "mem.buffers", Unit: "kb", Type: GAUGE, Desc: "系统buffers大小", Func: this.MemBuffer},
+		{Key: "mem.cached", Unit: "kb", Type: GAUGE, Desc: "系统cache大小", Func: this.MemCachedFunc},
+		{Key: "mem.used", Unit: "kb", Type: GAUGE, Desc: "已使用物理内存", Func: this.MemUsedFunc},
+		{Key: "mem.free", Unit: "kb", Type: GAUGE, Desc: "剩余物理内存", Func: this.MemFreeFunc},
+		{Key: "mem.used.rate", Unit: "%", Type: GAUGE, Desc: "物理内存使用率", Func: this.MemUsedRateFunc},
+		{Key: "mem.available", Unit: "kb", Type: GAUGE, Desc: "可用物理内存", Func: this.MemAvailableFunc},
+		{Key: "mem.shmem", Unit: "kb", Type: GAUGE, Desc: "共享内存及tmpfs", Func: this.memInfoFunc("Shmem")},
+		{Key: "mem.slab", Unit: "kb", Type: GAUGE, Desc: "内核slab", Func: this.memInfoFunc("Slab")},
+		{Key: "mem.slab.reclaimable", Unit: "kb", Type: GAUGE, Desc: "可回收的slab", Func: this.memInfoFunc("SReclaimable")},
+		{Key: "mem.slab.unreclaimable", Unit: "kb", Type: GAUGE, Desc: "不可回收的slab", Func: this.memInfoFunc("SUnreclaim")},
+		{Key: "mem.dirty", Unit: "kb", Type: GAUGE, Desc: "等待写回磁盘的脏页", Func: this.memInfoFunc("Dirty")},
+		{Key: "mem.writeback", Unit: "kb", Type: GAUGE, Desc: "正在写回磁盘的页", Func: this.memInfoFunc("Writeback")},
+		{Key: "mem.anon", Unit: "kb", Type: GAUGE, Desc: "匿名页", Func: this.memInfoFunc("AnonPages")},
+		{Key: "mem.mapped", Unit: "kb", Type: GAUGE, Desc: "mmap映射的文件页", Func: this.memInfoFunc("Mapped")},
+		{Key: "mem.committed", Unit: "kb", Type: GAUGE, Desc: "已申请的虚拟内存", Func: this.memInfoFunc("Committed_AS")},
+		{Key: "mem.commit.limit", Unit: "kb", Type: GAUGE, Desc: "可申请的虚拟内存上限", Func: this.memInfoFunc("CommitLimit")},
+		{Key: "mem.page.tables", Unit: "kb", Type: GAUGE, Desc: "页表", Func: this.memInfoFunc("PageTables")},
+		{Key: "mem.kernel.stack", Unit: "kb", Type: GAUGE, Desc: "内核栈", Func: this.memInfoFunc("KernelStack")},
+		{Key: "mem.hugepages.total", Type: GAUGE, Desc: "默认大小的大页总数", Func: this.memInfoFunc("HugePages_Total")},
+		{Key: "mem.hugepages.free", Type: GAUGE, Desc: "未分配的大页数", Func: this.memInfoFunc("HugePages_Free")},
+		{Key: "mem.hugepages.rsvd", Type: GAUGE, Desc: "已承诺分配但还未使用的大页数", Func: this.memInfoFunc("HugePages_Rsvd")},
+		{Key: "mem.hugepages.surp", Type: GAUGE, Desc: "超过nr_hugepages临时分配的大页数", Func: this.memInfoFunc("HugePages_Surp")},
+		{Key: "mem.hugepage.size", Unit: "kb", Type: GAUGE, Desc: "默认大页大小", Func: this.memInfoFunc("Hugepagesize")},
+		{Key: "mem.info", Type: GAUGE, Desc: "meminfo中任意字段", Label: "key", Func: this.MemInfoFunc},
+		{Key: "mem.swap.total", Unit: "kb", Type: GAUGE, Desc: "总交换内存", Func: this.SwapTotalFunc},
+		{Key: "mem.swap.used", Unit: "kb", Type: GAUGE, Desc: "已使用交换内存", Func: this.SwapUsedFunc},
+		{Key: "mem.swap.free", Unit: "kb", Type: GAUGE, Desc: "剩余交换内存", Func: this.SwapFreeFunc},
+		{Key: "mem.swap.used.rate", Unit: "%", Type: GAUGE, Desc: "交换内存使用率", Func: this.SwapUsedRateFunc},
+	}
+}
+
+//返回某进程的内存使用率, 与ps的%MEM列之和一致
 func MemUsedRateByProc(proc string) string {
-	return ExecOutput("ps axuwww|grep " + proc + "|grep -v grep|awk 'BEGIN{sum=0}{sum+=$4 }END{print sum}'")
+	mem := &Mem{}
+	err := mem.Collect()
+	if err != nil || mem.MemTotal == 0 {
+		return ""
+	}
+	procs, err := ProcessesByKeyword(proc)
+	if err != nil {
+		return ""
+	}
+	var sum float64
+	for _, p := range procs {
+		//ps截断到1位小数
+		sum += float64(p.Rss*1000/mem.MemTotal) / 10
+	}
+	return AwkNumber(sum)
 }
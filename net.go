@@ -77,8 +77,12 @@ type NetWork struct {
 	EthInMaxUseRate  float64 //内网网卡使用率
 	EthOutMaxUseRate float64 //外网网卡使用率
 
-	RecvSendDetail string //收发接口收发字节数详细信息
-	ModelDetail    string //网络接口型号带宽详细信息
+	RecvSendDetail string            //收发接口收发字节数详细信息
+	ModelDetail    string            //网络接口型号带宽详细信息
+	ProcRoot       string            //procfs根目录, 为空时使用ProcRoot
+	SysRoot        string            //sysfs根目录, 为空时使用SysRoot
+	Interfaces     map[string]string //网卡名=>地址, 不为空时只监控其中的网卡, 不查询当前网络命名空间, 用于快照及测试
+	Now            func() time.Time  //取当前时间, 为空时使用time.Now
 
 	/*
 		//外网网卡流入环比
@@ -104,6 +108,20 @@ func (this *NetWork) Collect() error {
 	return this.InitNetWorkInfo()
 }
 
+func (this *NetWork) Dump() {
+	for _, name := range this.IfiNames {
+		ifi := this.IfiMap[name]
+		fmt.Printf("Name:%s, Ip:%s, Speed:%f, RecvByte:%d, SendByte:%d, RecvByteAvg:%f, SendByteAvg:%f\n",
+			ifi.Name,
+			ifi.Ip,
+			ifi.Speed,
+			ifi.RecvByte,
+			ifi.SendByte,
+			ifi.RecvByteAvg,
+			ifi.SendByteAvg)
+	}
+}
+
 func (this *NetWork) ResetIfiData() {
 	this.RecvByteSum = 0
 	this.SendByteSum = 0
@@ -130,11 +148,14 @@ func (this *NetWork) ResetIfiData() {
 }
 
 func (this *NetWork) InitNetWorkInfo() error {
-	f, err := os.Open("/proc/net/dev")
+	f, err := os.Open(ProcPath(this.ProcRoot, "net", "dev"))
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	if this.IfiMap == nil {
+		this.IfiMap = map[string]*Ifi{}
+	}
 	reader := bufio.NewReader(f)
 	for {
 		line, err := reader.ReadString('\n')
@@ -166,28 +187,7 @@ func (this *NetWork) InitNetWorkInfo() error {
 		sendPkg, _ := strconv.ParseUint(fields[9], 10, 64)
 		sendErr, _ := strconv.ParseUint(fields[10], 10, 64)
 
-		//根据网卡名得到对应的网络接口
-		netifi, err := net.InterfaceByName(ethname)
-		if err != nil {
-			continue
-		}
-		var addrs []net.Addr
-		addrs, err = netifi.Addrs()
-		if err != nil {
-			continue
-		}
-		if len(addrs) == 0 {
-			continue
-		}
-		moniTag := true
-		for _, addr := range addrs {
-			cidr := addr.String()
-			if strings.Contains(cidr, "0.0.0.0") || strings.Contains(cidr, "127.0.0.1") {
-				//0.0.0.0 127.0.0.1 不监控
-				moniTag = false
-				break
-			}
-		}
+		ip, moniTag := this.ifiAddr(ethname)
 		if moniTag == false {
 			continue
 		}
@@ -206,9 +206,12 @@ func (this *NetWork) InitNetWorkInfo() error {
 			sendPkgAvg  float64
 			sendErrRate float64
 		)
-		now := time.Now().Unix()
+		now := currentTime(this.Now).Unix()
 		difftime := float64(now - ifi.Last)
-		if ifi.Last == 0 {
+		//计数器回绕或重置(如驱动重新加载)时与第一次采集一样处理
+		reset := recvByte < ifi.RecvByte || recvPkg < ifi.RecvPkg || recvErr < ifi.RecvErr ||
+			sendByte < ifi.SendByte || sendPkg < ifi.SendPkg || sendErr < ifi.SendErr
+		if ifi.Last == 0 || reset {
 			//第一次采集，没有时间差，不计算
 		} else {
 			if difftime > 0 {
@@ -226,7 +229,7 @@ func (this *NetWork) InitNetWorkInfo() error {
 		}
 
 		ifi.Name = ethname
-		ifi.Ip = addrs[0].String()
+		ifi.Ip = ip
 		ifi.RecvByte = recvByte
 		ifi.RecvPkg = recvPkg
 		ifi.RecvErr = recvErr
@@ -264,25 +267,11 @@ func (this *NetWork) InitNetWorkInfo() error {
 		this.RecvSendDetail += ifi.Ip + "=" + ifi.Name + "=(" + strconv.FormatFloat(recvByteAvg, 'f', 0, 64) + "|" +
 			strconv.FormatFloat(sendByteAvg, 'f', 0, 64) + ")$"
 
-		cmd := fmt.Sprintf("/sbin/ethtool %s 2>/dev/null", ethname)
-		output, err := Exec(cmd)
-		if err != nil {
-			continue
-		}
-		lines := strings.Split(output, "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "Speed") {
-				fields := strings.Split(line, ":")
-				if len(fields) != 2 {
-					continue
-				}
-				field2 := fields[1]
-				Trim(&field2)
-				field2 = strings.Replace(field2, "Mb/s", "", -1)
-				speed, err := strconv.ParseFloat(field2, 64) //Mb/s, 注意是小b
-				if err != nil {
-					continue
-				}
+		//网卡速率(Mb/s, 注意是小b), 与ethtool的Speed一致, 网卡down或速率未知时读取失败或为-1
+		content, err := GetFileContent(SysPath(this.SysRoot, "class", "net", ethname, "speed"))
+		if err == nil {
+			speed, err := strconv.ParseFloat(strings.TrimSpace(content), 64)
+			if err == nil && speed >= 0 {
 				ifi.Speed = speed
 				if speed > 0 {
 					inEthUseRate := float64(recvByteAvg*8*100) / float64(speed*1024*1024)
@@ -294,7 +283,6 @@ func (this *NetWork) InitNetWorkInfo() error {
 						this.EthOutMaxUseRate = outEthUseRate
 					}
 				}
-				break
 			}
 		}
 		this.ModelDetail += ifi.Name + "|" + ifi.Ip + "|" + FloatToString(ifi.Speed) + "$"
@@ -302,6 +290,38 @@ func (this *NetWork) InitNetWorkInfo() error {
 	return nil
 }
 
+//返回网卡的第一个地址, 第二个返回值为false时不监控该网卡
+//procfs根目录不是/proc时(宿主机或快照), 网卡可能不在当前网络命名空间, 找不到时只跳过lo
+func (this *NetWork) ifiAddr(ethname string) (string, bool) {
+	if this.Interfaces != nil {
+		addr, exists := this.Interfaces[ethname]
+		return addr, exists
+	}
+	//根据网卡名得到对应的网络接口
+	netifi, err := net.InterfaceByName(ethname)
+	if err != nil {
+		if ProcPath(this.ProcRoot) != "/proc" {
+			return "", ethname != "lo"
+		}
+		return "", false
+	}
+	addrs, err := netifi.Addrs()
+	if err != nil {
+		return "", false
+	}
+	if len(addrs) == 0 {
+		return "", false
+	}
+	for _, addr := range addrs {
+		cidr := addr.String()
+		if strings.Contains(cidr, "0.0.0.0") || strings.Contains(cidr, "127.0.0.1") {
+			//0.0.0.0 127.0.0.1 不监控
+			return "", false
+		}
+	}
+	return addrs[0].String(), true
+}
+
 //外网收包错误率
 func (this *NetWork) OutRecvErrRateSumFunc(args string) string {
 	return FloatToString(this.OutRecvErrRateSum)
@@ -355,6 +375,10 @@ func (this *NetWork) EthOutMaxUseRateFunc(args string) string {
 func (this *NetWork) GetIfiByIndex(args string) (*Ifi, error) {
 	index, err := strconv.Atoi(args)
 	if err != nil {
+		//也可直接传网卡名
+		if ifi, exists := this.IfiMap[args]; exists {
+			return ifi, nil
+		}
 		return nil, err
 	}
 	if index < 0 {
@@ -435,6 +459,60 @@ func (this *NetWork) EthSendErrRateFunc(args string) string {
 	return FloatToString(ifi.SendErrRate)
 }
 
+//接收的字节数
+func (this *NetWork) EthRecvByteFunc(args string) string {
+	ifi, err := this.GetIfiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatUint(ifi.RecvByte, 10)
+}
+
+//接收正确的包数
+func (this *NetWork) EthRecvPkgFunc(args string) string {
+	ifi, err := this.GetIfiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatUint(ifi.RecvPkg, 10)
+}
+
+//接收错误的包数
+func (this *NetWork) EthRecvErrFunc(args string) string {
+	ifi, err := this.GetIfiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatUint(ifi.RecvErr, 10)
+}
+
+//发送的字节数
+func (this *NetWork) EthSendByteFunc(args string) string {
+	ifi, err := this.GetIfiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatUint(ifi.SendByte, 10)
+}
+
+//发送正确的包数
+func (this *NetWork) EthSendPkgFunc(args string) string {
+	ifi, err := this.GetIfiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatUint(ifi.SendPkg, 10)
+}
+
+//发送错误的包数
+func (this *NetWork) EthSendErrFunc(args string) string {
+	ifi, err := this.GetIfiByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatUint(ifi.SendErr, 10)
+}
+
 //EthModelFunc ... 机器网卡信息
 func (this *NetWork) EthModelFunc(args string) string {
 	return this.ModelDetail
@@ -571,6 +649,93 @@ func (this *NetWork) OutEthRecvDayFunc(args string) string {
 }
 */
 
+//所有网卡名称
+func (this *NetWork) Names() []string {
+	return append([]string{}, this.IfiNames...)
+}
+
+func (this *NetWork) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "net.in.recv.bytes", Unit: "byte/s", Type: GAUGE, Desc: "内网网卡流入流量", Func: this.InEthRecvByteAvgFunc},
+		{Key: "net.in.send.bytes", Unit: "byte/s", Type: GAUGE, Desc: "内网网卡流出流量", Func: this.InEthSendByteAvgFunc},
+		{Key: "net.in.recv.pkgs", Unit: "pkg/s", Type: GAUGE, Desc: "内网收包速度", Func: this.InRecvPkgSumFunc},
+		{Key: "net.in.send.pkgs", Unit: "pkg/s", Type: GAUGE, Desc: "内网发包速度", Func: this.InSendPkgSumFunc},
+		{Key: "net.in.recv.err.rate", Type: GAUGE, Desc: "内网收包错误率", Func: this.InRecvErrRateSumFunc},
+		{Key: "net.in.send.err.rate", Type: GAUGE, Desc: "内网发包错误率", Func: this.InSendErrRateSumFunc},
+		{Key: "net.out.recv.bytes", Unit: "byte/s", Type: GAUGE, Desc: "外网网卡流入流量", Func: this.OutEthRecvByteAvgFunc},
+		{Key: "net.out.send.bytes", Unit: "byte/s", Type: GAUGE, Desc: "外网网卡流出流量", Func: this.OutEthSendByteAvgFunc},
+		{Key: "net.out.recv.pkgs", Unit: "pkg/s", Type: GAUGE, Desc: "外网收包速度", Func: this.OutRecvPkgSumFunc},
+		{Key: "net.out.send.pkgs", Unit: "pkg/s", Type: GAUGE, Desc: "外网发包速度", Func: this.OutSendPkgSumFunc},
+		{Key: "net.out.recv.err.rate", Type: GAUGE, Desc: "外网收包错误率", Func: this.OutRecvErrRateSumFunc},
+		{Key: "net.out.send.err.rate", Type: GAUGE, Desc: "外网发包错误率", Func: this.OutSendErrRateSumFunc},
+		{Key: "net.all.recv.bytes", Unit: "byte/s", Type: GAUGE, Desc: "所有网卡流入流量", Func: this.AllEthRecvByteAvgFunc},
+		{Key: "net.all.send.bytes", Unit: "byte/s", Type: GAUGE, Desc: "所有网卡流出流量", Func: this.EthRecvSendAvgFunc},
+		{Key: "net.in.max.use.rate", Unit: "%", Type: GAUGE, Desc: "网卡入带宽最大使用率", Func: this.EthInMaxUseRateFunc},
+		{Key: "net.out.max.use.rate", Unit: "%", Type: GAUGE, Desc: "网卡出带宽最大使用率", Func: this.EthOutMaxUseRateFunc},
+
+		{Key: "net.if.recv.bytes", Unit: "byte/s", Type: GAUGE, Desc: "接收速率", Label: "interface", Args: this.Names, Func: this.EthRecvByteAvgFunc},
+		{Key: "net.if.send.bytes", Unit: "byte/s", Type: GAUGE, Desc: "发送速率", Label: "interface", Args: this.Names, Func: this.EthSendByteAvgFunc},
+		{Key: "net.if.recv.pkgs", Unit: "pkg/s", Type: GAUGE, Desc: "包接收速率", Label: "interface", Args: this.Names, Func: this.EthRecvPkgAvgFunc},
+		{Key: "net.if.send.pkgs", Unit: "pkg/s", Type: GAUGE, Desc: "包发送速率", Label: "interface", Args: this.Names, Func: this.EthSendPkgAvgFunc},
+		{Key: "net.if.recv.err.rate", Type: GAUGE, Desc: "收包错误率", Label: "interface", Args: this.Names, Func: this.EthRecvErrRateFunc},
+		{Key: "net.if.send.err.rate", Type: GAUGE, Desc: "发包错误率", Label: "interface", Args: this.Names, Func: this.EthSendErrRateFunc},
+		{Key: "net.if.speed", Unit: "Mb/s", Type: GAUGE, Desc: "网卡速率", Label: "interface", Args: this.Names, Func: this.EthSpeedFunc},
+
+		{Key: "net.if.rx.bytes", Unit: "byte", Type: COUNTER, Desc: "接收的字节数", Label: "interface", Args: this.Names, Func: this.EthRecvByteFunc},
+		{Key: "net.if.rx.packets", Type: COUNTER, Desc: "接收正确的包数", Label: "interface", Args: this.Names, Func: this.EthRecvPkgFunc},
+		{Key: "net.if.rx.errors", Type: COUNTER, Desc: "接收错误的包数", Label: "interface", Args: this.Names, Func: this.EthRecvErrFunc},
+		{Key: "net.if.tx.bytes", Unit: "byte", Type: COUNTER, Desc: "发送的字节数", Label: "interface", Args: this.Names, Func: this.EthSendByteFunc},
+		{Key: "net.if.tx.packets", Type: COUNTER, Desc: "发送正确的包数", Label: "interface", Args: this.Names, Func: this.EthSendPkgFunc},
+		{Key: "net.if.tx.errors", Type: COUNTER, Desc: "发送错误的包数", Label: "interface", Args: this.Names, Func: this.EthSendErrFunc},
+
+		{Key: "net.model", Type: TEXT, Desc: "机器网卡信息", Func: this.EthModelFunc},
+		{Key: "net.bytes.set", Type: TEXT, Desc: "所有网卡流量信息", Func: this.EthByteSetFunc},
+		{Key: "net.port.conn", Type: GAUGE, Desc: "某端口tcp连接数", Label: "port", Func: ConnNumByPort},
+	}
+}
+
+//某端口tcp连接数, 与netstat -nt一致: 读/proc/net/tcp、tcp6, 本地或远端端口匹配, 不含LISTEN状态
 func ConnNumByPort(port string) string {
-	return ExecOutput("netstat -pnt |grep ':" + port + "\\b' |wc -l")
+	want, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return ""
+	}
+	num := 0
+	for _, name := range []string{"tcp", "tcp6"} {
+		content, err := GetFileContent(ProcPath("", "net", name))
+		if err != nil {
+			continue
+		}
+		for row, line := range strings.Split(content, "\n") {
+			if row == 0 {
+				continue
+			}
+			//sl local_address rem_address st ..., 地址格式为十六进制ip:十六进制端口
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				continue
+			}
+			if fields[3] == "0A" {
+				//LISTEN
+				continue
+			}
+			if hexPort(fields[1]) == want || hexPort(fields[2]) == want {
+				num++
+			}
+		}
+	}
+	return strconv.Itoa(num)
+}
+
+//从/proc/net/tcp的地址中取端口, 失败返回0
+func hexPort(addr string) uint64 {
+	pos := strings.LastIndex(addr, ":")
+	if pos < 0 {
+		return 0
+	}
+	port, err := strconv.ParseUint(addr[pos+1:], 16, 16)
+	if err != nil {
+		return 0
+	}
+	return port
 }
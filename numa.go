@@ -0,0 +1,234 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type NumaNode struct {
+	Index       int
+	MemTotal    uint64            //节点内存大小(kb)
+	MemFree     uint64            //节点未使用内存(kb)
+	FilePages   uint64            //节点上的文件页, 包括buffers、cached(kb)
+	Shmem       uint64            //节点上的共享内存及tmpfs, 包含在FilePages中但不能回收(kb)
+	MemUsed     uint64            //节点已使用内存, 不含可回收的文件页(kb)
+	MemUsedRate float64           //节点内存使用率
+	MemInfo     map[string]uint64 //节点meminfo所有字段, 名称不带Node N前缀及冒号
+
+	//numastat, 从系统启动后累加的页数
+	NumaHit       uint64 //本应分配在该节点且分配成功
+	NumaMiss      uint64 //本应分配在其他节点但因内存不足分配到该节点
+	NumaForeign   uint64 //本应分配在该节点但因内存不足分配到其他节点
+	InterleaveHit uint64 //交错分配策略下分配在该节点
+
+	//计算得出
+	HitPerSecond           float64 //一个周期平均每秒numa_hit
+	MissPerSecond          float64 //一个周期平均每秒numa_miss
+	ForeignPerSecond       float64 //一个周期平均每秒numa_foreign
+	InterleaveHitPerSecond float64 //一个周期平均每秒interleave_hit
+	Last                   int64   //上次采集时间
+}
+
+//读/sys/devices/system/node/node*/{meminfo,numastat}, 采集每个NUMA节点的内存使用及跨节点分配情况,
+//多路服务器上某个节点内存耗尽时Mem.MemUsedRate可能仍然正常
+type Numa struct {
+	NodeMap     map[int]*NumaNode //节点编号=>节点
+	NodeIndexes []int             //节点编号
+	SysRoot     string            //sysfs根目录, 为空时使用SysRoot
+}
+
+func (this *Numa) Dump() {
+	for _, index := range this.NodeIndexes {
+		node := this.NodeMap[index]
+		fmt.Printf("node%d MemTotal:%d, MemFree:%d, FilePages:%d, Shmem:%d, MemUsed:%d (kb), MemUsedRate:%f, HitPerSecond:%f, MissPerSecond:%f, ForeignPerSecond:%f, InterleaveHitPerSecond:%f\n",
+			node.Index,
+			node.MemTotal,
+			node.MemFree,
+			node.FilePages,
+			node.Shmem,
+			node.MemUsed,
+			node.MemUsedRate,
+			node.HitPerSecond,
+			node.MissPerSecond,
+			node.ForeignPerSecond,
+			node.InterleaveHitPerSecond)
+	}
+}
+
+func (this *Numa) Collect() error {
+	dirs, err := ioutil.ReadDir(SysPath(this.SysRoot, "devices", "system", "node"))
+	if err != nil {
+		return err
+	}
+	if this.NodeMap == nil {
+		this.NodeMap = map[int]*NumaNode{}
+	}
+	indexes := []int{}
+	for _, dir := range dirs {
+		if !strings.HasPrefix(dir.Name(), "node") {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(dir.Name(), "node"))
+		if err != nil {
+			continue
+		}
+		content, err := GetFileContent(SysPath(this.SysRoot, "devices", "system", "node", dir.Name(), "meminfo"))
+		if err != nil {
+			//内存热插拔时节点目录可能还在
+			continue
+		}
+		node, exists := this.NodeMap[index]
+		if !exists {
+			node = &NumaNode{Index: index}
+			this.NodeMap[index] = node
+		}
+		node.MemInfo = parseNodeMemInfo(content)
+		node.MemTotal = node.MemInfo["MemTotal"]
+		node.MemFree = node.MemInfo["MemFree"]
+		node.FilePages = node.MemInfo["FilePages"]
+		node.Shmem = node.MemInfo["Shmem"]
+		//节点没有MemAvailable, free + 文件页近似为可用内存; shmem不能回收, 与Mem按MemAvailable计算一致, 计入已使用
+		available := node.MemFree + node.FilePages
+		if available >= node.Shmem {
+			available -= node.Shmem
+		} else {
+			available = 0
+		}
+		if available > node.MemTotal {
+			available = node.MemTotal
+		}
+		node.MemUsed = node.MemTotal - available
+		node.MemUsedRate = 0
+		if node.MemTotal > 0 {
+			node.MemUsedRate = float64(node.MemUsed) / float64(node.MemTotal) * 100
+		}
+		this.collectNumaStat(dir.Name(), node)
+		indexes = append(indexes, index)
+	}
+	if len(indexes) == 0 {
+		return errors.New("no numa node found")
+	}
+	sort.Ints(indexes)
+	online := map[int]bool{}
+	for _, index := range indexes {
+		online[index] = true
+	}
+	for index := range this.NodeMap {
+		if !online[index] {
+			delete(this.NodeMap, index)
+		}
+	}
+	this.NodeIndexes = indexes
+	return nil
+}
+
+//解析Node 0 MemTotal:       65777044 kB
+func parseNodeMemInfo(content string) map[string]uint64 {
+	memInfo := map[string]uint64{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "Node" {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		memInfo[strings.TrimSuffix(fields[2], ":")] = value
+	}
+	return memInfo
+}
+
+func (this *Numa) collectNumaStat(dir string, node *NumaNode) {
+	content, err := GetFileContent(SysPath(this.SysRoot, "devices", "system", "node", dir, "numastat"))
+	if err != nil {
+		return
+	}
+	stat := map[string]uint64{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		stat[fields[0]], _ = strconv.ParseUint(fields[1], 10, 64)
+	}
+	now := time.Now().Unix()
+	difftime := float64(now - node.Last)
+	node.HitPerSecond = 0
+	node.MissPerSecond = 0
+	node.ForeignPerSecond = 0
+	node.InterleaveHitPerSecond = 0
+	if node.Last > 0 && difftime > 0 {
+		node.HitPerSecond = float64(CounterDiff(stat["numa_hit"], node.NumaHit)) / difftime
+		node.MissPerSecond = float64(CounterDiff(stat["numa_miss"], node.NumaMiss)) / difftime
+		node.ForeignPerSecond = float64(CounterDiff(stat["numa_foreign"], node.NumaForeign)) / difftime
+		node.InterleaveHitPerSecond = float64(CounterDiff(stat["interleave_hit"], node.InterleaveHit)) / difftime
+	}
+	node.NumaHit = stat["numa_hit"]
+	node.NumaMiss = stat["numa_miss"]
+	node.NumaForeign = stat["numa_foreign"]
+	node.InterleaveHit = stat["interleave_hit"]
+	node.Last = now
+}
+
+//按节点编号取节点, 也可传node1这样的名称
+func (this *Numa) GetNodeByIndex(args string) (*NumaNode, error) {
+	index, err := strconv.Atoi(strings.TrimPrefix(args, "node"))
+	if err != nil {
+		return nil, err
+	}
+	node, exists := this.NodeMap[index]
+	if !exists {
+		return nil, errors.New("numa node not found")
+	}
+	return node, nil
+}
+
+//所有节点编号
+func (this *Numa) Nodes() []string {
+	nodes := []string{}
+	for _, index := range this.NodeIndexes {
+		nodes = append(nodes, strconv.Itoa(index))
+	}
+	return nodes
+}
+
+func (this *Numa) nodeFunc(value func(node *NumaNode) string) MetricFunc {
+	return func(args string) string {
+		node, err := this.GetNodeByIndex(args)
+		if err != nil {
+			return ""
+		}
+		return value(node)
+	}
+}
+
+//内存使用率最高的节点的使用率
+func (this *Numa) MaxMemUsedRateFunc(args string) string {
+	var max float64
+	for _, index := range this.NodeIndexes {
+		if rate := this.NodeMap[index].MemUsedRate; rate > max {
+			max = rate
+		}
+	}
+	return FloatToString(max)
+}
+
+func (this *Numa) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "numa.mem.total", Unit: "kb", Type: GAUGE, Desc: "节点内存大小", Label: "node", Args: this.Nodes, Func: this.nodeFunc(func(node *NumaNode) string { return strconv.FormatUint(node.MemTotal, 10) })},
+		{Key: "numa.mem.free", Unit: "kb", Type: GAUGE, Desc: "节点未使用内存", Label: "node", Args: this.Nodes, Func: this.nodeFunc(func(node *NumaNode) string { return strconv.FormatUint(node.MemFree, 10) })},
+		{Key: "numa.mem.used", Unit: "kb", Type: GAUGE, Desc: "节点已使用内存(不含可回收的文件页)", Label: "node", Args: this.Nodes, Func: this.nodeFunc(func(node *NumaNode) string { return strconv.FormatUint(node.MemUsed, 10) })},
+		{Key: "numa.mem.used.rate", Unit: "%", Type: GAUGE, Desc: "节点内存使用率", Label: "node", Args: this.Nodes, Func: this.nodeFunc(func(node *NumaNode) string { return FloatToString(node.MemUsedRate) })},
+		{Key: "numa.hit.avg", Unit: "1/s", Type: GAUGE, Desc: "每秒在本节点分配成功的页数", Label: "node", Args: this.Nodes, Func: this.nodeFunc(func(node *NumaNode) string { return FloatToString(node.HitPerSecond) })},
+		{Key: "numa.miss.avg", Unit: "1/s", Type: GAUGE, Desc: "每秒因其他节点内存不足分配到本节点的页数", Label: "node", Args: this.Nodes, Func: this.nodeFunc(func(node *NumaNode) string { return FloatToString(node.MissPerSecond) })},
+		{Key: "numa.foreign.avg", Unit: "1/s", Type: GAUGE, Desc: "每秒因本节点内存不足分配到其他节点的页数", Label: "node", Args: this.Nodes, Func: this.nodeFunc(func(node *NumaNode) string { return FloatToString(node.ForeignPerSecond) })},
+		{Key: "numa.interleave.hit.avg", Unit: "1/s", Type: GAUGE, Desc: "每秒交错分配到本节点的页数", Label: "node", Args: this.Nodes, Func: this.nodeFunc(func(node *NumaNode) string { return FloatToString(node.InterleaveHitPerSecond) })},
+		{Key: "numa.mem.used.rate.max", Unit: "%", Type: GAUGE, Desc: "内存使用率最高的节点的使用率", Func: this.MaxMemUsedRateFunc},
+	}
+}
@@ -0,0 +1,35 @@
+package system
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNumaMemUsed(t *testing.T) {
+	cases := []struct {
+		kernel   string
+		node     int
+		memUsed  uint64
+		usedRate float64
+	}{
+		{"kernel-4.18", 0, 9404436, 57.82},
+		//Shmem超过MemFree+FilePages, 可用内存按0计算
+		{"kernel-6.8", 0, 8126464, 100},
+		{"kernel-6.8", 1, 1994772, 24.51},
+	}
+	for _, c := range cases {
+		n := &Numa{SysRoot: filepath.Join("testdata", c.kernel, "2", "sys")}
+		if err := n.Collect(); err != nil {
+			t.Fatal(err)
+		}
+		node, exists := n.NodeMap[c.node]
+		if !exists {
+			t.Fatalf("%s node%d not found", c.kernel, c.node)
+		}
+		//shmem不能回收, 计入已使用
+		if node.MemUsed != c.memUsed {
+			t.Errorf("%s node%d MemUsed = %d, want %d", c.kernel, c.node, node.MemUsed, c.memUsed)
+		}
+		assertFloat(t, c.kernel+" MemUsedRate", node.MemUsedRate, c.usedRate, 0.005)
+	}
+}
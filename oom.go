@@ -0,0 +1,289 @@
+package system
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//一次OOM杀进程
+type OOMEvent struct {
+	Seq        uint64    //内核日志序号
+	Time       time.Time //杀进程时间, 由开机时间及日志时间戳计算, 取不到开机时间时为零值
+	Pid        int       //被杀进程pid
+	Name       string    //被杀进程名
+	Trigger    string    //触发OOM的进程名, 即xxx invoked oom-killer
+	Cgroup     string    //被杀进程所在的内存cgroup, 老内核为Task in xxx killed中的cgroup
+	Constraint string    //CONSTRAINT_NONE为整机内存不足, CONSTRAINT_MEMCG为cgroup内存超限, 老内核只能区分后者
+	TotalVm    uint64    //被杀时的虚拟内存(kb)
+	AnonRss    uint64    //被杀时的匿名页(kb)
+	FileRss    uint64    //被杀时的文件页(kb)
+	ShmemRss   uint64    //被杀时的共享内存(kb)
+	Message    string    //Killed process那行日志
+}
+
+//被杀时的物理内存(kb)
+func (this *OOMEvent) Rss() uint64 {
+	return this.AnonRss + this.FileRss + this.ShmemRss
+}
+
+//如java(4321,/system.slice/app.service,rss:7655555kb)
+func (this *OOMEvent) String() string {
+	return fmt.Sprintf("%s(%d,%s,rss:%dkb)", this.Name, this.Pid, this.Cgroup, this.Rss())
+}
+
+//OOM杀进程统计: 次数取/proc/vmstat的oom_kill(4.13以后的内核才有), 被杀进程从内核日志中的Killed process解析,
+//读内核日志需要root权限或kernel.dmesg_restrict为0, 没有权限时只有次数
+type OOM struct {
+	KillCount    uint64            //从系统启动后累加的OOM杀进程次数
+	KillNew      uint64            //一个周期新增的OOM杀进程次数, 内核没有oom_kill时为新解析到的事件数
+	HasKillCount bool              //内核是否有oom_kill计数
+	Events       []*OOMEvent       //一个周期新解析到的OOM事件, 第一次采集时日志中已有的事件不算新增
+	LastEvent    *OOMEvent         //最近一次OOM事件, 包括第一次采集时日志中已有的
+	LogAvailable bool              //是否能读内核日志
+	Handler      func(e *OOMEvent) //每解析到一个新事件时调用, 可为nil
+	ProcRoot     string            //procfs根目录, 为空时使用ProcRoot
+	KmsgPath     string            //内核日志, 为空时读/dev/kmsg, 也可指向同样格式的文件, 设置了Kmsg时不使用
+	Kmsg         *Kmsg             //共用的内核日志, 需要先于OOM采集, 为空时自己读KmsgPath
+
+	kmsg    *Kmsg      //没有共用的Kmsg时自己读
+	read    bool       //是否已采集过
+	context oomContext //上个周期末尾尚未结束的OOM报告, 报告跨周期时用于补全新事件
+}
+
+//一次OOM报告中Killed process之前的信息
+type oomContext struct {
+	trigger    string //触发OOM的进程名
+	cgroup     string //被杀进程所在的内存cgroup
+	constraint string //CONSTRAINT_NONE、CONSTRAINT_MEMCG等
+}
+
+func (this *OOM) Dump() {
+	fmt.Printf("KillCount:%d, KillNew:%d, events:%d\n", this.KillCount, this.KillNew, len(this.Events))
+	for _, e := range this.Events {
+		fmt.Printf("seq:%d, time:%s, pid:%d, name:%s, trigger:%s, cgroup:%s, constraint:%s, rss:%d (kb)\n",
+			e.Seq,
+			e.Time.Format("2006-01-02 15:04:05"),
+			e.Pid,
+			e.Name,
+			e.Trigger,
+			e.Cgroup,
+			e.Constraint,
+			e.Rss())
+	}
+}
+
+func (this *OOM) Collect() error {
+	vmstat := &VMStat{ProcRoot: this.ProcRoot}
+	if err := vmstat.Collect(); err != nil {
+		return err
+	}
+	count, hasCount := vmstat.Counter("oom_kill")
+
+	kmsg := this.Kmsg
+	if kmsg == nil {
+		if this.kmsg == nil {
+			this.kmsg = &Kmsg{}
+		}
+		this.kmsg.Path = this.KmsgPath
+		//读内核日志失败时只有次数
+		this.kmsg.Collect()
+		kmsg = this.kmsg
+	}
+	this.LogAvailable = kmsg.Available
+	events := []*OOMEvent{}
+	for _, e := range parseOOMEvents(kmsg.all, bootTimeByStat(this.ProcRoot), &this.context) {
+		this.LastEvent = e
+		//Records为all中新增的部分, 第一次采集时为空
+		if this.read && len(kmsg.Records) > 0 && e.Seq >= kmsg.Records[0].Seq {
+			events = append(events, e)
+		}
+	}
+
+	this.KillNew = 0
+	if hasCount && this.read && this.HasKillCount {
+		this.KillNew = CounterDiff(count, this.KillCount)
+	} else if !hasCount {
+		this.KillNew = uint64(len(events))
+	}
+	this.KillCount = count
+	this.HasKillCount = hasCount
+	this.Events = events
+	this.read = true
+	if this.Handler != nil {
+		for _, e := range events {
+			this.Handler(e)
+		}
+	}
+	return nil
+}
+
+//从内核日志中解析OOM事件, 依次为:
+//xxx invoked oom-killer: ...
+//oom-kill:constraint=CONSTRAINT_MEMCG,...,task_memcg=/xxx,task=java,pid=4321,uid=0 (4.19以后)
+//Task in /xxx killed as a result of limit of /xxx (4.19以前的cgroup OOM)
+//Out of memory: Killed process 4321 (java) total-vm:123kB, anon-rss:45kB, file-rss:0kB, shmem-rss:0kB
+//Memory cgroup out of memory: Killed process ... (cgroup OOM)
+//Killed process 4321 (java) total-vm:... (4.19以前, 前一行为Out of memory: Kill process 4321 (java) score 901 or sacrifice child)
+//context为上次解析到末尾时尚未结束的报告, 解析后更新为本次末尾的
+func parseOOMEvents(records []*KmsgRecord, btime time.Time, context *oomContext) []*OOMEvent {
+	events := []*OOMEvent{}
+	for _, record := range records {
+		message := record.Message
+		if pos := strings.Index(message, " invoked oom-killer:"); pos >= 0 {
+			*context = oomContext{trigger: message[:pos]}
+			continue
+		}
+		if strings.HasPrefix(message, "oom-kill:") {
+			for _, field := range strings.Split(strings.TrimPrefix(message, "oom-kill:"), ",") {
+				pos := strings.Index(field, "=")
+				if pos < 0 {
+					continue
+				}
+				switch field[:pos] {
+				case "constraint":
+					context.constraint = field[pos+1:]
+				case "task_memcg":
+					context.cgroup = field[pos+1:]
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(message, "Task in ") {
+			if end := strings.Index(message, " killed as a result of limit of "); end >= 0 {
+				context.cgroup = message[len("Task in "):end]
+				context.constraint = "CONSTRAINT_MEMCG"
+			}
+			continue
+		}
+		pos := strings.Index(message, "Killed process ")
+		if pos < 0 {
+			continue
+		}
+		rest := message[pos+len("Killed process "):]
+		fields := strings.SplitN(rest, " ", 2)
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil || len(fields) < 2 {
+			continue
+		}
+		e := &OOMEvent{
+			Seq:        record.Seq,
+			Pid:        pid,
+			Trigger:    context.trigger,
+			Cgroup:     context.cgroup,
+			Constraint: context.constraint,
+			Message:    message,
+		}
+		rest = fields[1]
+		if strings.HasPrefix(rest, "(") {
+			if end := strings.LastIndex(rest, ") "); end > 0 {
+				e.Name, rest = rest[1:end], rest[end+2:]
+			} else {
+				e.Name, rest = strings.TrimSuffix(rest[1:], ")"), ""
+			}
+		}
+		if !btime.IsZero() {
+			e.Time = btime.Add(time.Duration(record.Timestamp) * time.Microsecond)
+		}
+		if e.Constraint == "" && strings.HasPrefix(message, "Memory cgroup out of memory") {
+			e.Constraint = "CONSTRAINT_MEMCG"
+		}
+		for _, field := range strings.Fields(strings.Replace(rest, ",", " ", -1)) {
+			pos := strings.Index(field, ":")
+			if pos < 0 || !strings.HasSuffix(field, "kB") {
+				continue
+			}
+			value, _ := strconv.ParseUint(strings.TrimSuffix(field[pos+1:], "kB"), 10, 64)
+			switch field[:pos] {
+			case "total-vm":
+				e.TotalVm = value
+			case "anon-rss":
+				e.AnonRss = value
+			case "file-rss":
+				e.FileRss = value
+			case "shmem-rss":
+				e.ShmemRss = value
+			}
+		}
+		events = append(events, e)
+		*context = oomContext{}
+	}
+	return events
+}
+
+//开机时间, 取/proc/stat的btime, 失败时返回零值
+func bootTimeByStat(root string) time.Time {
+	content, err := GetFileContent(ProcPath(root, "stat"))
+	if err != nil {
+		return time.Time{}
+	}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "btime" {
+			btime, err := strconv.ParseInt(fields[1], 10, 64)
+			if err == nil {
+				return time.Unix(btime, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+//从系统启动后累加的OOM杀进程次数, 内核没有oom_kill时返回空
+func (this *OOM) KillCountFunc(args string) string {
+	if !this.HasKillCount {
+		return ""
+	}
+	return strconv.FormatUint(this.KillCount, 10)
+}
+
+//一个周期新增的OOM杀进程次数
+func (this *OOM) KillNewFunc(args string) string {
+	return strconv.FormatUint(this.KillNew, 10)
+}
+
+//一个周期新解析到的OOM事件数
+func (this *OOM) EventNumFunc(args string) string {
+	return strconv.Itoa(len(this.Events))
+}
+
+//一个周期被杀的进程, 如java(4321,/system.slice/app.service,rss:7655555kb)
+func (this *OOM) EventSetFunc(args string) string {
+	ret := []string{}
+	for _, e := range this.Events {
+		ret = append(ret, e.String())
+	}
+	return strings.Join(ret, ",")
+}
+
+func (this *OOM) lastEventFunc(value func(e *OOMEvent) string) MetricFunc {
+	return func(args string) string {
+		if this.LastEvent == nil {
+			return ""
+		}
+		return value(this.LastEvent)
+	}
+}
+
+//最近一次OOM杀进程的时间戳, 取不到开机时间时返回空
+func (this *OOM) LastTimeFunc(args string) string {
+	if this.LastEvent == nil || this.LastEvent.Time.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(this.LastEvent.Time.Unix(), 10)
+}
+
+func (this *OOM) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "oom.kill.count", Type: COUNTER, Desc: "OOM杀进程次数", Func: this.KillCountFunc},
+		{Key: "oom.kill.new", Type: GAUGE, Desc: "一个周期新增的OOM杀进程次数", Func: this.KillNewFunc},
+		{Key: "oom.event.num", Type: GAUGE, Desc: "一个周期从内核日志解析到的OOM事件数", Func: this.EventNumFunc},
+		{Key: "oom.event.set", Type: TEXT, Desc: "一个周期被OOM杀掉的进程", Func: this.EventSetFunc},
+		{Key: "oom.last.pid", Type: GAUGE, Desc: "最近一次被OOM杀掉的进程pid", Func: this.lastEventFunc(func(e *OOMEvent) string { return strconv.Itoa(e.Pid) })},
+		{Key: "oom.last.name", Type: TEXT, Desc: "最近一次被OOM杀掉的进程名", Func: this.lastEventFunc(func(e *OOMEvent) string { return e.Name })},
+		{Key: "oom.last.cgroup", Type: TEXT, Desc: "最近一次被OOM杀掉的进程所在cgroup", Func: this.lastEventFunc(func(e *OOMEvent) string { return e.Cgroup })},
+		{Key: "oom.last.rss", Unit: "kb", Type: GAUGE, Desc: "最近一次被OOM杀掉的进程被杀时的物理内存", Func: this.lastEventFunc(func(e *OOMEvent) string { return strconv.FormatUint(e.Rss(), 10) })},
+		{Key: "oom.last.time", Unit: "s", Type: GAUGE, Desc: "最近一次OOM杀进程的时间戳", Func: this.LastTimeFunc},
+	}
+}
@@ -0,0 +1,94 @@
+package system
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOOMLastTime(t *testing.T) {
+	o := &OOM{
+		ProcRoot: goldenProcRoot("kernel-6.8", "1"),
+		KmsgPath: filepath.Join("testdata", "kernel-6.8", "1", "kmsg"),
+	}
+	if err := o.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	if o.LastEvent == nil {
+		t.Fatal("no oom event")
+	}
+	//开机时间为1700000000
+	if o.LastEvent.Time.Unix() <= 1700000000 {
+		t.Errorf("LastEvent.Time = %v, want after boot time", o.LastEvent.Time)
+	}
+	if value := o.LastTimeFunc(""); value != strconv.FormatInt(o.LastEvent.Time.Unix(), 10) {
+		t.Errorf("oom.last.time = %s, want %d", value, o.LastEvent.Time.Unix())
+	}
+	//取不到开机时间时不上报0
+	o.LastEvent.Time = time.Time{}
+	if value := o.LastTimeFunc(""); value != "" {
+		t.Errorf("oom.last.time = %s, want empty", value)
+	}
+	o.LastEvent = nil
+	if value := o.LastTimeFunc(""); value != "" {
+		t.Errorf("oom.last.time = %s, want empty", value)
+	}
+}
+
+//OOM报告跨两次采集: 第一次读到invoked oom-killer等行, 第二次才读到Killed process
+func TestOOMReportAcrossCycles(t *testing.T) {
+	cases := []struct {
+		kernel     string
+		lastSeq    string //第一次采集读到的最后一条日志
+		trigger    string
+		cgroup     string
+		constraint string
+	}{
+		{"kernel-3.10", "5007", "python", "/docker/3f2a1b", "CONSTRAINT_MEMCG"},
+		{"kernel-6.8", "5007", "python3", "/kubepods.slice/kubepods-burstable.slice/pod7c1/cri-containerd-9ab.scope", "CONSTRAINT_MEMCG"},
+	}
+	for _, c := range cases {
+		t.Run(c.kernel, func(t *testing.T) {
+			content, err := ioutil.ReadFile(goldenKmsgPath(c.kernel, "2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			//截断到lastSeq, 模拟第一次采集时报告还没写完
+			lines := strings.SplitAfter(string(content), "\n")
+			first := ""
+			for _, line := range lines {
+				first += line
+				if strings.Contains(line, ","+c.lastSeq+",") {
+					break
+				}
+			}
+			path := filepath.Join(t.TempDir(), "kmsg")
+			if err := ioutil.WriteFile(path, []byte(first), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			o := &OOM{ProcRoot: goldenProcRoot(c.kernel, "1"), KmsgPath: path}
+			if err := o.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			o.ProcRoot = goldenProcRoot(c.kernel, "2")
+			if err := o.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			if len(o.Events) != 1 {
+				t.Fatalf("got %d events, want 1", len(o.Events))
+			}
+			e := o.Events[0]
+			if e.Pid != 5555 || e.Trigger != c.trigger || e.Cgroup != c.cgroup || e.Constraint != c.constraint {
+				t.Errorf("got pid %d, trigger %s, cgroup %s, constraint %s, want 5555, %s, %s, %s",
+					e.Pid, e.Trigger, e.Cgroup, e.Constraint, c.trigger, c.cgroup, c.constraint)
+			}
+		})
+	}
+}
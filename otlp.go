@@ -0,0 +1,342 @@
+package system
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+//OTLP/HTTP protobuf导出, 指标名遵循OpenTelemetry system.*语义约定, 如system.cpu.utilization、
+//system.memory.usage、system.filesystem.usage、system.disk.io、system.network.io
+type OtlpExporter struct {
+	Registry *Registry
+	Url      string            //如http://127.0.0.1:4318/v1/metrics
+	Headers  map[string]string //额外的请求头, 如认证信息
+	Resource map[string]string //额外的resource属性, 默认已包含host.name, host.arch, os.type, os.description
+	Client   *http.Client
+	ProcRoot string //procfs根目录, 为空时使用ProcRoot, 累计值的起始时间取其中stat的btime
+}
+
+func NewOtlpExporter(registry *Registry, url string) *OtlpExporter {
+	return &OtlpExporter{
+		Registry: registry,
+		Url:      url,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+//一个指标及其数据点, Sum为累计值(CUMULATIVE), 否则为Gauge
+type OtlpMetric struct {
+	Name      string
+	Desc      string
+	Unit      string
+	Sum       bool
+	Monotonic bool
+	Points    []OtlpPoint
+}
+
+type OtlpPoint struct {
+	Attrs []string //属性, 依次为key, value
+	Value float64
+}
+
+func (this *OtlpMetric) add(value float64, attrs ...string) {
+	this.Points = append(this.Points, OtlpPoint{Attrs: attrs, Value: value})
+}
+
+//采集一次并导出
+func (this *OtlpExporter) Export() error {
+	this.Registry.Collect()
+	body := this.Encode(time.Now())
+	req, err := http.NewRequest("POST", this.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for key, value := range this.Headers {
+		req.Header.Set(key, value)
+	}
+	client := this.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		content, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("otlp export failed: %s %s", resp.Status, content)
+	}
+	return nil
+}
+
+//resource属性
+func (this *OtlpExporter) resourceAttrs() []string {
+	hostname, _ := os.Hostname()
+	attrs := []string{
+		"host.name", hostname,
+		"host.arch", runtime.GOARCH,
+		"os.type", runtime.GOOS,
+		"os.description", OsVersion(""),
+	}
+	for key, value := range this.Resource {
+		attrs = append(attrs, key, value)
+	}
+	return attrs
+}
+
+//按名称取注册表中的采集器, 未注册时返回nil
+func (this *OtlpExporter) collector(name string) Collector {
+	c, _ := this.Registry.Collector(name)
+	return c
+}
+
+//从注册表中的采集器取当前值, 转换为OpenTelemetry语义约定的指标, 单位统一为字节、秒, 使用率为0~1;
+//采集器未注册或不是本库的类型时跳过
+func (this *OtlpExporter) Metrics() []*OtlpMetric {
+	metrics := []*OtlpMetric{}
+	if cpu, ok := this.collector("cpu").(*Cpu); ok {
+		utilization := &OtlpMetric{Name: "system.cpu.utilization", Desc: "cpu各状态时间占比", Unit: "1"}
+		utilization.add(cpu.UserRate/100, "cpu.mode", "user")
+		utilization.add(cpu.SystemRate/100, "cpu.mode", "system")
+		utilization.add(cpu.IdleRate/100, "cpu.mode", "idle")
+		utilization.add(cpu.IoWaitRate/100, "cpu.mode", "iowait")
+		utilization.add(cpu.NiceRate/100, "cpu.mode", "nice")
+		utilization.add(cpu.IrqRate/100, "cpu.mode", "interrupt")
+		utilization.add(cpu.SoftIrqRate/100, "cpu.mode", "softirq")
+		utilization.add(cpu.StealRate/100, "cpu.mode", "steal")
+		cpuTime := &OtlpMetric{Name: "system.cpu.time", Desc: "cpu各状态累计时间", Unit: "s", Sum: true, Monotonic: true}
+		cpuTime.add(float64(cpu.User)/clockTicks, "cpu.mode", "user")
+		cpuTime.add(float64(cpu.Nice)/clockTicks, "cpu.mode", "nice")
+		cpuTime.add(float64(cpu.System)/clockTicks, "cpu.mode", "system")
+		cpuTime.add(float64(cpu.Idle)/clockTicks, "cpu.mode", "idle")
+		cpuTime.add(float64(cpu.Iowait)/clockTicks, "cpu.mode", "iowait")
+		cpuTime.add(float64(cpu.Irq)/clockTicks, "cpu.mode", "interrupt")
+		cpuTime.add(float64(cpu.SoftIrq)/clockTicks, "cpu.mode", "softirq")
+		cpuTime.add(float64(cpu.Steal)/clockTicks, "cpu.mode", "steal")
+		metrics = append(metrics, utilization, cpuTime)
+	}
+	if load, ok := this.collector("load").(*Load); ok {
+		load1 := &OtlpMetric{Name: "system.cpu.load_average.1m", Desc: "一分钟平均负载", Unit: "{thread}"}
+		load1.add(load.Load1)
+		load5 := &OtlpMetric{Name: "system.cpu.load_average.5m", Desc: "五分钟平均负载", Unit: "{thread}"}
+		load5.add(load.Load5)
+		load15 := &OtlpMetric{Name: "system.cpu.load_average.15m", Desc: "十五分钟平均负载", Unit: "{thread}"}
+		load15.add(load.Load15)
+		metrics = append(metrics, load1, load5, load15)
+	} else if load, err := strconv.ParseFloat(LoadAvg1(""), 64); err == nil {
+		load1 := &OtlpMetric{Name: "system.cpu.load_average.1m", Desc: "一分钟平均负载", Unit: "{thread}"}
+		load1.add(load)
+		metrics = append(metrics, load1)
+	}
+	if mem, ok := this.collector("mem").(*Mem); ok {
+		//各状态互不重叠, 合计为MemTotal: used不含buffers、cached及可回收的slab, free为meminfo中的MemFree而不是可用内存
+		free := mem.MemInfo["MemFree"]
+		reclaimable := free + mem.Buffers + mem.Cached + mem.SReclaimable
+		if reclaimable > mem.MemTotal {
+			reclaimable = mem.MemTotal
+		}
+		states := []struct {
+			name  string
+			value uint64
+		}{
+			{"used", mem.MemTotal - reclaimable},
+			{"free", free},
+			{"buffers", mem.Buffers},
+			{"cached", mem.Cached},
+			{"slab_reclaimable", mem.SReclaimable},
+		}
+		usage := &OtlpMetric{Name: "system.memory.usage", Desc: "各状态内存大小", Unit: "By", Sum: true}
+		utilization := &OtlpMetric{Name: "system.memory.utilization", Desc: "各状态内存占比", Unit: "1"}
+		for _, state := range states {
+			usage.add(float64(state.value)*1024, "system.memory.state", state.name)
+			if mem.MemTotal > 0 {
+				utilization.add(float64(state.value)/float64(mem.MemTotal), "system.memory.state", state.name)
+			}
+		}
+		paging := &OtlpMetric{Name: "system.paging.usage", Desc: "交换内存大小", Unit: "By", Sum: true}
+		paging.add(float64(mem.SwapUsed)*1024, "system.paging.state", "used")
+		paging.add(float64(mem.SwapFree)*1024, "system.paging.state", "free")
+		metrics = append(metrics, usage, utilization, paging)
+	}
+	if disk, ok := this.collector("disk").(*Disk); ok {
+		usage := &OtlpMetric{Name: "system.filesystem.usage", Desc: "文件系统空间", Unit: "By", Sum: true}
+		utilization := &OtlpMetric{Name: "system.filesystem.utilization", Desc: "文件系统使用率", Unit: "1"}
+		for _, mount := range disk.Mounts() {
+			fs := disk.FsMap[mount]
+			usage.add(float64(fs.Used)*1024, "system.device", fs.FsName, "system.filesystem.mountpoint", mount, "system.filesystem.state", "used")
+			usage.add(float64(fs.Free)*1024, "system.device", fs.FsName, "system.filesystem.mountpoint", mount, "system.filesystem.state", "free")
+			utilization.add(fs.UsedRate/100, "system.device", fs.FsName, "system.filesystem.mountpoint", mount)
+		}
+		metrics = append(metrics, usage, utilization)
+	}
+	if diskio, ok := this.collector("diskio").(*DiskIO); ok {
+		io := &OtlpMetric{Name: "system.disk.io", Desc: "磁盘读写字节数", Unit: "By", Sum: true, Monotonic: true}
+		ops := &OtlpMetric{Name: "system.disk.operations", Desc: "磁盘读写次数", Unit: "{operation}", Sum: true, Monotonic: true}
+		merged := &OtlpMetric{Name: "system.disk.merged", Desc: "磁盘合并读写次数", Unit: "{operation}", Sum: true, Monotonic: true}
+		opTime := &OtlpMetric{Name: "system.disk.operation_time", Desc: "磁盘读写花费的时间", Unit: "s", Sum: true, Monotonic: true}
+		ioTime := &OtlpMetric{Name: "system.disk.io_time", Desc: "磁盘I/O操作花费的时间", Unit: "s", Sum: true, Monotonic: true}
+		for _, name := range diskio.PartiNames {
+			parti := diskio.PartiMap[name]
+			io.add(float64(parti.Rsect)*512, "system.device", name, "disk.io.direction", "read")
+			io.add(float64(parti.Wsect)*512, "system.device", name, "disk.io.direction", "write")
+			ops.add(float64(parti.Rio), "system.device", name, "disk.io.direction", "read")
+			ops.add(float64(parti.Wio), "system.device", name, "disk.io.direction", "write")
+			merged.add(float64(parti.Rmerge), "system.device", name, "disk.io.direction", "read")
+			merged.add(float64(parti.Wmerge), "system.device", name, "disk.io.direction", "write")
+			opTime.add(float64(parti.Relapsed)/1000, "system.device", name, "disk.io.direction", "read")
+			opTime.add(float64(parti.Welapsed)/1000, "system.device", name, "disk.io.direction", "write")
+			ioTime.add(float64(parti.Elapsed)/1000, "system.device", name)
+		}
+		metrics = append(metrics, io, ops, merged, opTime, ioTime)
+	}
+	if network, ok := this.collector("net").(*NetWork); ok {
+		io := &OtlpMetric{Name: "system.network.io", Desc: "网卡收发字节数", Unit: "By", Sum: true, Monotonic: true}
+		packets := &OtlpMetric{Name: "system.network.packets", Desc: "网卡收发包数", Unit: "{packet}", Sum: true, Monotonic: true}
+		errs := &OtlpMetric{Name: "system.network.errors", Desc: "网卡收发错误包数", Unit: "{error}", Sum: true, Monotonic: true}
+		for _, name := range network.IfiNames {
+			ifi := network.IfiMap[name]
+			io.add(float64(ifi.RecvByte), "network.interface.name", name, "network.io.direction", "receive")
+			io.add(float64(ifi.SendByte), "network.interface.name", name, "network.io.direction", "transmit")
+			packets.add(float64(ifi.RecvPkg), "network.interface.name", name, "network.io.direction", "receive")
+			packets.add(float64(ifi.SendPkg), "network.interface.name", name, "network.io.direction", "transmit")
+			errs.add(float64(ifi.RecvErr), "network.interface.name", name, "network.io.direction", "receive")
+			errs.add(float64(ifi.SendErr), "network.interface.name", name, "network.io.direction", "transmit")
+		}
+		metrics = append(metrics, io, packets, errs)
+	}
+	return metrics
+}
+
+//编码为ExportMetricsServiceRequest, 累计值的起始时间为开机时间,
+//取/proc/stat的btime而不是由uptime计算, 每次导出的起始时间相同
+func (this *OtlpExporter) Encode(now time.Time) []byte {
+	timestamp := uint64(now.UnixNano())
+	startTime := timestamp
+	if bootTime := bootTimeByStat(this.ProcRoot); !bootTime.IsZero() {
+		startTime = uint64(bootTime.UnixNano())
+	}
+
+	//Resource
+	resource := &protoWriter{}
+	attrs := this.resourceAttrs()
+	for i := 0; i+1 < len(attrs); i += 2 {
+		resource.message(1, otlpKeyValue(attrs[i], attrs[i+1]))
+	}
+
+	//ScopeMetrics
+	scope := &protoWriter{}
+	scope.string(1, "github.com/lycclsltt/system")
+	scopeMetrics := &protoWriter{}
+	scopeMetrics.message(1, scope)
+	for _, m := range this.Metrics() {
+		if len(m.Points) == 0 {
+			continue
+		}
+		points := []*protoWriter{}
+		for _, p := range m.Points {
+			//NumberDataPoint
+			point := &protoWriter{}
+			if m.Sum {
+				point.fixed64(2, startTime)
+			}
+			point.fixed64(3, timestamp)
+			point.fixed64(4, math.Float64bits(p.Value))
+			for i := 0; i+1 < len(p.Attrs); i += 2 {
+				point.message(7, otlpKeyValue(p.Attrs[i], p.Attrs[i+1]))
+			}
+			points = append(points, point)
+		}
+		data := &protoWriter{}
+		for _, point := range points {
+			data.message(1, point)
+		}
+		metric := &protoWriter{}
+		metric.string(1, m.Name)
+		metric.string(2, m.Desc)
+		metric.string(3, m.Unit)
+		if m.Sum {
+			//AGGREGATION_TEMPORALITY_CUMULATIVE
+			data.varint(2, 2)
+			if m.Monotonic {
+				data.varint(3, 1)
+			}
+			metric.message(7, data)
+		} else {
+			metric.message(5, data)
+		}
+		scopeMetrics.message(2, metric)
+	}
+
+	resourceMetrics := &protoWriter{}
+	resourceMetrics.message(1, resource)
+	resourceMetrics.message(2, scopeMetrics)
+	request := &protoWriter{}
+	request.message(1, resourceMetrics)
+	return request.buf
+}
+
+//KeyValue{key, AnyValue{string_value}}
+func otlpKeyValue(key string, value string) *protoWriter {
+	anyValue := &protoWriter{}
+	anyValue.string(1, value)
+	kv := &protoWriter{}
+	kv.string(1, key)
+	kv.message(2, anyValue)
+	return kv
+}
+
+//protobuf编码, 只实现OTLP用到的几种类型
+type protoWriter struct {
+	buf []byte
+}
+
+func (this *protoWriter) rawVarint(v uint64) {
+	for v >= 0x80 {
+		this.buf = append(this.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	this.buf = append(this.buf, byte(v))
+}
+
+//wireType: 0 varint, 1 64位, 2 长度前缀
+func (this *protoWriter) tag(field int, wireType int) {
+	this.rawVarint(uint64(field<<3 | wireType))
+}
+
+func (this *protoWriter) varint(field int, v uint64) {
+	this.tag(field, 0)
+	this.rawVarint(v)
+}
+
+func (this *protoWriter) fixed64(field int, v uint64) {
+	this.tag(field, 1)
+	for i := 0; i < 8; i++ {
+		this.buf = append(this.buf, byte(v>>(8*uint(i))))
+	}
+}
+
+//空字符串为默认值, 不编码
+func (this *protoWriter) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	this.tag(field, 2)
+	this.rawVarint(uint64(len(s)))
+	this.buf = append(this.buf, s...)
+}
+
+func (this *protoWriter) message(field int, m *protoWriter) {
+	this.tag(field, 2)
+	this.rawVarint(uint64(len(m.buf)))
+	this.buf = append(this.buf, m.buf...)
+}
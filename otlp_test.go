@@ -0,0 +1,118 @@
+package system
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newOtlpTestRegistry(t *testing.T) *Registry {
+	registry := NewRegistry()
+	if err := registry.Register("cpu", &Cpu{ProcRoot: goldenProcRoot("kernel-6.8", "1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register("mem", &Mem{ProcRoot: goldenProcRoot("kernel-6.8", "1")}); err != nil {
+		t.Fatal(err)
+	}
+	//同名但不是本库类型的采集器应跳过
+	if err := registry.Register("net", &testCollector{}); err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestOtlpMemoryUsage(t *testing.T) {
+	registry := newOtlpTestRegistry(t)
+	registry.Collect()
+	exporter := NewOtlpExporter(registry, "")
+	metrics := map[string]*OtlpMetric{}
+	for _, m := range exporter.Metrics() {
+		metrics[m.Name] = m
+	}
+	if _, exists := metrics["system.network.io"]; exists {
+		t.Error("system.network.io exported from a foreign collector")
+	}
+	usage, exists := metrics["system.memory.usage"]
+	if !exists {
+		t.Fatal("system.memory.usage not found")
+	}
+	c, _ := registry.Collector("mem")
+	mem := c.(*Mem)
+	var sum float64
+	for _, p := range usage.Points {
+		if p.Value < 0 {
+			t.Errorf("%v = %f", p.Attrs, p.Value)
+		}
+		sum += p.Value
+	}
+	//各状态互不重叠, 合计为MemTotal
+	if math.Abs(sum-float64(mem.MemTotal)*1024) > 1 {
+		t.Errorf("sum of states = %f, want %d", sum, mem.MemTotal*1024)
+	}
+	var rate float64
+	for _, p := range metrics["system.memory.utilization"].Points {
+		rate += p.Value
+	}
+	if math.Abs(rate-1) > 0.000001 {
+		t.Errorf("sum of utilization = %f, want 1", rate)
+	}
+}
+
+func TestOtlpExport(t *testing.T) {
+	var body []byte
+	var contentType, token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		token = r.Header.Get("Authorization")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	exporter := NewOtlpExporter(newOtlpTestRegistry(t), server.URL)
+	exporter.Headers = map[string]string{"Authorization": "Bearer test"}
+	exporter.Resource = map[string]string{"service.name": "system"}
+	if err := exporter.Export(); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/x-protobuf" || token != "Bearer test" {
+		t.Errorf("unexpected headers: %s, %s", contentType, token)
+	}
+	for _, str := range []string{"system.cpu.utilization", "system.memory.usage", "slab_reclaimable", "service.name", "github.com/lycclsltt/system"} {
+		if !bytes.Contains(body, []byte(str)) {
+			t.Errorf("%s not found in request", str)
+		}
+	}
+}
+
+func TestOtlpExportFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	exporter := NewOtlpExporter(newOtlpTestRegistry(t), server.URL)
+	if err := exporter.Export(); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestOtlpStartTime(t *testing.T) {
+	registry := newOtlpTestRegistry(t)
+	registry.Collect()
+	exporter := NewOtlpExporter(registry, "")
+	exporter.ProcRoot = goldenProcRoot("kernel-6.8", "1")
+	//NumberDataPoint.start_time_unix_nano(fixed64, 字段2)为btime 1700000000
+	want := make([]byte, 9)
+	want[0] = 2<<3 | 1
+	binary.LittleEndian.PutUint64(want[1:], uint64(time.Unix(1700000000, 0).UnixNano()))
+	for _, now := range []time.Time{time.Unix(1700000100, 0), time.Unix(1700000110, 500)} {
+		if !bytes.Contains(exporter.Encode(now), want) {
+			t.Errorf("start time at %v is not btime", now)
+		}
+	}
+}
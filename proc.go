@@ -1,10 +1,112 @@
 package system
 
 import (
-	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+//进程cpu使用率的采样间隔
+const procCpuSampleInterval = 500 * time.Millisecond
+
+//每秒时钟滴答数(USER_HZ), 1jiffies=0.01秒
+const clockTicks = 100
+
+type Process struct {
+	Pid     int
+	Comm    string //进程名, 即/proc/[pid]/stat第2列, 最长15个字符
+	Cmdline string //完整命令行, 内核线程为[进程名]
+	Utime   uint64 //用户态cpu时间(jiffies)
+	Stime   uint64 //内核态cpu时间(jiffies)
+	Rss     uint64 //常驻内存(kb)
+}
+
+//读/proc/[pid], 采集所有进程, 采集过程中退出的进程跳过
+func Processes() ([]*Process, error) {
+	dirs, err := ioutil.ReadDir(ProcPath(""))
+	if err != nil {
+		return nil, err
+	}
+	pageSize := uint64(os.Getpagesize()) / 1024
+	procs := []*Process{}
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(dir.Name())
+		if err != nil || !dir.IsDir() {
+			continue
+		}
+		content, err := GetFileContent(ProcPath("", dir.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		//进程名可能包含空格和括号, 以最后一个')'分隔
+		start := strings.Index(content, "(")
+		end := strings.LastIndex(content, ")")
+		if start < 0 || end < start {
+			continue
+		}
+		//fields[0]为第3列state
+		fields := strings.Fields(content[end+1:])
+		if len(fields) < 22 {
+			continue
+		}
+		proc := &Process{Pid: pid, Comm: content[start+1 : end]}
+		proc.Utime, _ = strconv.ParseUint(fields[11], 10, 64)
+		proc.Stime, _ = strconv.ParseUint(fields[12], 10, 64)
+		rss, _ := strconv.ParseUint(fields[21], 10, 64)
+		proc.Rss = rss * pageSize
+
+		cmdline, err := GetFileContent(ProcPath("", dir.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		cmdline = strings.TrimRight(cmdline, "\x00")
+		if cmdline == "" {
+			proc.Cmdline = "[" + proc.Comm + "]"
+		} else {
+			proc.Cmdline = strings.Replace(cmdline, "\x00", " ", -1)
+		}
+		procs = append(procs, proc)
+	}
+	return procs, nil
+}
+
+//命令行包含keyword的进程, 与ps auxww|grep keyword|grep -v grep一致, 排除命令行包含grep的进程
+func ProcessesByKeyword(keyword string) ([]*Process, error) {
+	procs, err := Processes()
+	if err != nil {
+		return nil, err
+	}
+	ret := []*Process{}
+	for _, proc := range procs {
+		if strings.Contains(proc.Cmdline, keyword) && !strings.Contains(proc.Cmdline, "grep") {
+			ret = append(ret, proc)
+		}
+	}
+	return ret, nil
+}
+
+//命令行包含keyword的进程数
 func ProcNumByKeyword(keyword string) string {
-	cmd := fmt.Sprintf("ps auxww | grep %s | grep -v grep | wc -l", keyword)
-	return ExecOutput(cmd)
+	procs, err := ProcessesByKeyword(keyword)
+	if err != nil {
+		return ""
+	}
+	return strconv.Itoa(len(procs))
+}
+
+//进程名包含proc的进程, 与top输出的COMMAND列一致
+func processesByComm(proc string) (map[int]*Process, error) {
+	procs, err := Processes()
+	if err != nil {
+		return nil, err
+	}
+	ret := map[int]*Process{}
+	for _, p := range procs {
+		if strings.Contains(p.Comm, proc) && !strings.Contains(p.Comm, "grep") {
+			ret[p.Pid] = p
+		}
+	}
+	return ret, nil
 }
@@ -0,0 +1,100 @@
+package system
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	PrometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+//Prometheus采集接口, 每次请求先采集一次再输出所有指标, 同时支持text和OpenMetrics格式
+type PrometheusHandler struct {
+	Registry  *Registry
+	Namespace string //指标名前缀, 如system_cpu_iowait_rate
+}
+
+func NewPrometheusHandler(registry *Registry) *PrometheusHandler {
+	return &PrometheusHandler{Registry: registry, Namespace: "system"}
+}
+
+func (this *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	//部分采集器出错时仍输出其他采集器的指标
+	this.Registry.Collect()
+	samples := this.Registry.Samples()
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", OpenMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", PrometheusContentType)
+	}
+	WritePrometheus(w, this.Namespace, samples, openMetrics)
+}
+
+//Prometheus指标名, key中的.替换为_
+func PrometheusName(namespace string, key string) string {
+	name := strings.Replace(key, ".", "_", -1)
+	if namespace == "" {
+		return name
+	}
+	return namespace + "_" + name
+}
+
+//按Prometheus text或OpenMetrics格式输出, TEXT类型及非数值的指标跳过,
+//COUNTER类型指标名以_total结尾, 带参数的指标以Metric.Label为标签名
+func WritePrometheus(w io.Writer, namespace string, samples []Sample, openMetrics bool) error {
+	writer := bufio.NewWriter(w)
+	var last *Metric
+	for _, sample := range samples {
+		m := sample.Metric
+		if m.Type == TEXT {
+			continue
+		}
+		value, err := strconv.ParseFloat(sample.Value, 64)
+		if err != nil {
+			continue
+		}
+		name := PrometheusName(namespace, m.Key)
+		//OpenMetrics中counter的family名不带_total, 样本名带_total
+		family := name
+		if m.Type == COUNTER {
+			name += "_total"
+			if !openMetrics {
+				family = name
+			}
+		}
+		if m != last {
+			help := m.Desc
+			if m.Unit != "" {
+				help += "(" + m.Unit + ")"
+			}
+			writer.WriteString("# HELP " + family + " " + escapePrometheus(help, openMetrics) + "\n")
+			writer.WriteString("# TYPE " + family + " " + strings.ToLower(m.Type) + "\n")
+			last = m
+		}
+		writer.WriteString(name)
+		if m.Label != "" {
+			writer.WriteString("{" + m.Label + "=\"" + escapePrometheus(sample.Arg, true) + "\"}")
+		}
+		writer.WriteString(" " + strconv.FormatFloat(value, 'f', -1, 64) + "\n")
+	}
+	if openMetrics {
+		writer.WriteString("# EOF\n")
+	}
+	return writer.Flush()
+}
+
+//转义\和换行, 标签值及OpenMetrics的HELP中还需转义"
+func escapePrometheus(str string, quote bool) string {
+	str = strings.Replace(str, "\\", "\\\\", -1)
+	str = strings.Replace(str, "\n", "\\n", -1)
+	if quote {
+		str = strings.Replace(str, "\"", "\\\"", -1)
+	}
+	return str
+}
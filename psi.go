@@ -0,0 +1,198 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//PSI的资源类型, irq为6.1以上内核才有, 且只有full
+var pressureResources = []string{"cpu", "memory", "io", "irq"}
+
+//some或full一行
+type PressureStat struct {
+	Avg10     float64 //最近10秒停顿时间百分比
+	Avg60     float64 //最近60秒停顿时间百分比
+	Avg300    float64 //最近300秒停顿时间百分比
+	Total     uint64  //从系统启动后累加的停顿时间(us)
+	TotalRate float64 //一个周期平均每秒停顿时间(us/s)
+}
+
+type PressureResource struct {
+	Name string
+	Some *PressureStat //至少一个任务停顿, irq没有
+	Full *PressureStat //所有非空闲任务同时停顿, 5.13以前的cpu没有
+	Last int64         //上次采集时间
+}
+
+//读/proc/pressure/{cpu,memory,io}, 内核不支持PSI(4.20以前、未开启CONFIG_PSI或启动参数psi=0)时不报错, Available为false
+type Pressure struct {
+	ResourceMap   map[string]*PressureResource //资源类型=>停顿信息
+	ResourceNames []string                     //支持的资源类型
+	Available     bool                         //内核是否支持PSI
+	ProcRoot      string                       //procfs根目录, 为空时使用ProcRoot
+}
+
+func (this *Pressure) Dump() {
+	if !this.Available {
+		fmt.Println("PSI not available")
+		return
+	}
+	for _, name := range this.ResourceNames {
+		resource := this.ResourceMap[name]
+		for _, stat := range []struct {
+			kind string
+			stat *PressureStat
+		}{{"some", resource.Some}, {"full", resource.Full}} {
+			if stat.stat == nil {
+				continue
+			}
+			fmt.Printf("%s %s avg10:%.2f, avg60:%.2f, avg300:%.2f, total:%d, totalRate:%f\n",
+				name,
+				stat.kind,
+				stat.stat.Avg10,
+				stat.stat.Avg60,
+				stat.stat.Avg300,
+				stat.stat.Total,
+				stat.stat.TotalRate)
+		}
+	}
+}
+
+func (this *Pressure) Collect() error {
+	if this.ResourceMap == nil {
+		this.ResourceMap = map[string]*PressureResource{}
+	}
+	now := time.Now().Unix()
+	names := []string{}
+	for _, name := range pressureResources {
+		content, err := GetFileContent(ProcPath(this.ProcRoot, "pressure", name))
+		if err != nil {
+			//不存在或psi=0时读取返回EOPNOTSUPP
+			delete(this.ResourceMap, name)
+			continue
+		}
+		resource, exists := this.ResourceMap[name]
+		if !exists {
+			resource = &PressureResource{Name: name}
+			this.ResourceMap[name] = resource
+		}
+		difftime := float64(now - resource.Last)
+		some, full := resource.Some, resource.Full
+		resource.Some, resource.Full = nil, nil
+		for _, line := range strings.Split(content, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			stat, err := parsePressureLine(fields[1:])
+			if err != nil {
+				return errors.New("invalid pressure " + name + ": " + line)
+			}
+			var last *PressureStat
+			switch fields[0] {
+			case "some":
+				last, resource.Some = some, stat
+			case "full":
+				last, resource.Full = full, stat
+			default:
+				continue
+			}
+			if last != nil && resource.Last > 0 && difftime > 0 {
+				stat.TotalRate = float64(CounterDiff(stat.Total, last.Total)) / difftime
+			}
+		}
+		resource.Last = now
+		names = append(names, name)
+	}
+	this.ResourceNames = names
+	this.Available = len(names) > 0
+	if !this.Available {
+		//区分没有PSI与procfs根目录错误
+		if _, err := os.Stat(ProcPath(this.ProcRoot, "stat")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//解析avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePressureLine(fields []string) (*PressureStat, error) {
+	stat := &PressureStat{}
+	for _, field := range fields {
+		pos := strings.Index(field, "=")
+		if pos < 0 {
+			return nil, errors.New("invalid field " + field)
+		}
+		value := field[pos+1:]
+		var err error
+		switch field[:pos] {
+		case "avg10":
+			stat.Avg10, err = strconv.ParseFloat(value, 64)
+		case "avg60":
+			stat.Avg60, err = strconv.ParseFloat(value, 64)
+		case "avg300":
+			stat.Avg300, err = strconv.ParseFloat(value, 64)
+		case "total":
+			stat.Total, err = strconv.ParseUint(value, 10, 64)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stat, nil
+}
+
+//支持的资源类型
+func (this *Pressure) Names() []string {
+	return append([]string{}, this.ResourceNames...)
+}
+
+func (this *Pressure) statFunc(full bool, value func(stat *PressureStat) string) MetricFunc {
+	return func(args string) string {
+		resource, exists := this.ResourceMap[args]
+		if !exists {
+			return ""
+		}
+		stat := resource.Some
+		if full {
+			stat = resource.Full
+		}
+		if stat == nil {
+			return ""
+		}
+		return value(stat)
+	}
+}
+
+//是否支持PSI, 1为支持
+func (this *Pressure) AvailableFunc(args string) string {
+	if this.Available {
+		return "1"
+	}
+	return "0"
+}
+
+func (this *Pressure) Metrics() []*Metric {
+	avg10 := func(stat *PressureStat) string { return FloatToString(stat.Avg10) }
+	avg60 := func(stat *PressureStat) string { return FloatToString(stat.Avg60) }
+	avg300 := func(stat *PressureStat) string { return FloatToString(stat.Avg300) }
+	total := func(stat *PressureStat) string { return strconv.FormatUint(stat.Total, 10) }
+	totalRate := func(stat *PressureStat) string { return FloatToString(stat.TotalRate) }
+	return []*Metric{
+		{Key: "psi.available", Type: GAUGE, Desc: "内核是否支持PSI", Func: this.AvailableFunc},
+		{Key: "psi.some.avg10", Unit: "%", Type: GAUGE, Desc: "最近10秒至少一个任务停顿的时间百分比", Label: "resource", Args: this.Names, Func: this.statFunc(false, avg10)},
+		{Key: "psi.some.avg60", Unit: "%", Type: GAUGE, Desc: "最近60秒至少一个任务停顿的时间百分比", Label: "resource", Args: this.Names, Func: this.statFunc(false, avg60)},
+		{Key: "psi.some.avg300", Unit: "%", Type: GAUGE, Desc: "最近300秒至少一个任务停顿的时间百分比", Label: "resource", Args: this.Names, Func: this.statFunc(false, avg300)},
+		{Key: "psi.some.total", Unit: "us", Type: COUNTER, Desc: "至少一个任务停顿的累计时间", Label: "resource", Args: this.Names, Func: this.statFunc(false, total)},
+		{Key: "psi.some.total.avg", Unit: "us/s", Type: GAUGE, Desc: "每秒至少一个任务停顿的时间", Label: "resource", Args: this.Names, Func: this.statFunc(false, totalRate)},
+		{Key: "psi.full.avg10", Unit: "%", Type: GAUGE, Desc: "最近10秒所有任务同时停顿的时间百分比", Label: "resource", Args: this.Names, Func: this.statFunc(true, avg10)},
+		{Key: "psi.full.avg60", Unit: "%", Type: GAUGE, Desc: "最近60秒所有任务同时停顿的时间百分比", Label: "resource", Args: this.Names, Func: this.statFunc(true, avg60)},
+		{Key: "psi.full.avg300", Unit: "%", Type: GAUGE, Desc: "最近300秒所有任务同时停顿的时间百分比", Label: "resource", Args: this.Names, Func: this.statFunc(true, avg300)},
+		{Key: "psi.full.total", Unit: "us", Type: COUNTER, Desc: "所有任务同时停顿的累计时间", Label: "resource", Args: this.Names, Func: this.statFunc(true, total)},
+		{Key: "psi.full.total.avg", Unit: "us/s", Type: GAUGE, Desc: "每秒所有任务同时停顿的时间", Label: "resource", Args: this.Names, Func: this.statFunc(true, totalRate)},
+	}
+}
@@ -0,0 +1,75 @@
+package system
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPressure(t *testing.T) {
+	cases := []struct {
+		kernel    string
+		available string
+		names     string
+		cpuFull   bool
+	}{
+		//没有/proc/pressure时不报错
+		{"kernel-3.10", "0", "", false},
+		{"kernel-4.18", "0", "", false},
+		{"kernel-5.10", "1", "cpu,memory,io", false},
+		{"kernel-6.8", "1", "cpu,memory,io,irq", true},
+	}
+	for _, c := range cases {
+		t.Run(c.kernel, func(t *testing.T) {
+			p := &Pressure{ProcRoot: goldenProcRoot(c.kernel, "1")}
+			registry := NewRegistry()
+			if err := registry.Register("psi", p); err != nil {
+				t.Fatal(err)
+			}
+			if err := registry.Collect(); err != nil {
+				t.Fatal(err)
+			}
+			for _, resource := range p.ResourceMap {
+				resource.Last -= goldenInterval
+			}
+			p.ProcRoot = goldenProcRoot(c.kernel, "2")
+			if err := registry.Collect(); err != nil {
+				t.Fatal(err)
+			}
+
+			values := map[string]string{}
+			for _, sample := range registry.Samples() {
+				values[sample.Metric.Key+"["+sample.Arg+"]"] = sample.Value
+			}
+			if values["psi.available[]"] != c.available {
+				t.Errorf("psi.available = %s, want %s", values["psi.available[]"], c.available)
+			}
+			if got := strings.Join(p.Names(), ","); got != c.names {
+				t.Errorf("Names = %s, want %s", got, c.names)
+			}
+			if c.available == "0" {
+				//没有PSI时只有psi.available
+				if len(values) != 1 {
+					t.Errorf("got samples %v, want psi.available only", values)
+				}
+				return
+			}
+			for resource, want := range map[string]string{"cpu": "125000.00", "memory": "12000.00", "io": "250000.00"} {
+				if got := values["psi.some.total.avg["+resource+"]"]; got != want {
+					t.Errorf("psi.some.total.avg[%s] = %s, want %s", resource, got, want)
+				}
+			}
+			if _, exists := values["psi.full.avg10[cpu]"]; exists != c.cpuFull {
+				t.Errorf("psi.full.avg10[cpu] exists = %v, want %v", exists, c.cpuFull)
+			}
+		})
+	}
+}
+
+//procfs根目录错误时报错, 与没有PSI区分
+func TestPressureInvalidRoot(t *testing.T) {
+	p := &Pressure{ProcRoot: filepath.Join("testdata", "none", "proc")}
+	if err := p.Collect(); err == nil {
+		t.Fatal("want error")
+	}
+}
@@ -0,0 +1,203 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+//指标类型
+const (
+	GAUGE   = "GAUGE"   //瞬时值
+	COUNTER = "COUNTER" //从系统启动开始累加的计数
+	TEXT    = "TEXT"    //非数值, 如型号、版本、xxx|yyy$ 形式的集合
+)
+
+//指标函数, args为参数(分区名/挂载点/网卡名/进程关键字等), 无参数指标忽略
+type MetricFunc func(args string) string
+
+type Metric struct {
+	Key       string          //指标唯一标识, 如cpu.iowait.rate
+	Unit      string          //单位
+	Type      string          //GAUGE, COUNTER, TEXT
+	Desc      string          //说明
+	Label     string          //参数名(device, mount, interface...), 无参数指标为空
+	Args      func() []string //参数所有取值, 为nil时只能带参数单独查询
+	Func      MetricFunc      //取值函数
+	Collector string          //所属采集器名, 注册时填充
+}
+
+//采集器, Cpu、Mem、Disk、DiskIO、NetWork等均实现该接口
+type Collector interface {
+	Collect() error
+	Dump()
+	Metrics() []*Metric
+}
+
+//一次采集得到的指标值
+type Sample struct {
+	Metric *Metric
+	Arg    string //参数取值, 无参数指标为空
+	Value  string
+}
+
+type Registry struct {
+	lock       sync.Mutex
+	names      []string             //采集器名称集合, 按注册顺序
+	collectors map[string]Collector //采集器名称=>采集器
+	keys       []string             //指标key集合, 按注册顺序
+	metrics    map[string]*Metric   //指标key=>指标
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: map[string]Collector{},
+		metrics:    map[string]*Metric{},
+	}
+}
+
+//注册采集器及其全部指标, 采集器名称和指标key均不能重复
+func (this *Registry) Register(name string, c Collector) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if _, exists := this.collectors[name]; exists {
+		return errors.New("collector already registered: " + name)
+	}
+	metrics := c.Metrics()
+	for _, m := range metrics {
+		if m.Func == nil {
+			return errors.New("metric has no func: " + m.Key)
+		}
+		if _, exists := this.metrics[m.Key]; exists {
+			return errors.New("metric already registered: " + m.Key)
+		}
+	}
+	for _, m := range metrics {
+		m.Collector = name
+		this.metrics[m.Key] = m
+		this.keys = append(this.keys, m.Key)
+	}
+	this.collectors[name] = c
+	this.names = append(this.names, name)
+	return nil
+}
+
+//按名称返回采集器
+func (this *Registry) Collector(name string) (Collector, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	c, exists := this.collectors[name]
+	return c, exists
+}
+
+//所有采集器名称
+func (this *Registry) CollectorNames() []string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return append([]string{}, this.names...)
+}
+
+//依次采集所有采集器, 某个采集器出错不影响其他采集器, 返回第一个错误
+func (this *Registry) Collect() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	var first error
+	for _, name := range this.names {
+		err := this.collectors[name].Collect()
+		if err != nil && first == nil {
+			first = fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return first
+}
+
+//按key返回指标
+func (this *Registry) Metric(key string) (*Metric, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	m, exists := this.metrics[key]
+	return m, exists
+}
+
+//所有指标, 按注册顺序
+func (this *Registry) Metrics() []*Metric {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	metrics := make([]*Metric, 0, len(this.keys))
+	for _, key := range this.keys {
+		metrics = append(metrics, this.metrics[key])
+	}
+	return metrics
+}
+
+//按key和参数取指标值
+func (this *Registry) Get(key string, args string) (string, error) {
+	m, exists := this.Metric(key)
+	if !exists {
+		return "", errors.New("metric not found: " + key)
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return m.Func(args), nil
+}
+
+//取所有指标当前值, 带参数的指标按Args展开, 取值为空的跳过
+func (this *Registry) Samples() []Sample {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	samples := []Sample{}
+	for _, key := range this.keys {
+		m := this.metrics[key]
+		if m.Label == "" {
+			value := m.Func("")
+			if value != "" {
+				samples = append(samples, Sample{Metric: m, Value: value})
+			}
+			continue
+		}
+		if m.Args == nil {
+			continue
+		}
+		for _, arg := range m.Args() {
+			value := m.Func(arg)
+			if value != "" {
+				samples = append(samples, Sample{Metric: m, Arg: arg, Value: value})
+			}
+		}
+	}
+	return samples
+}
+
+//注册了本库所有采集器全部指标的注册表, 采集器名称或指标key重复属于编码错误, 直接panic
+func NewDefaultRegistry() *Registry {
+	registry := NewRegistry()
+	//oom、machine共用kmsg读到的内核日志, 一个周期只读一次, kmsg需要先于它们注册
+	kmsg := &Kmsg{}
+	for _, c := range []struct {
+		name      string
+		collector Collector
+	}{
+		{"cpu", &Cpu{}},
+		{"softirqs", &SoftIrqs{}},
+		{"mem", &Mem{}},
+		{"vmstat", &VMStat{}},
+		{"hugepages", &HugePages{}},
+		{"numa", &Numa{}},
+		{"kmsg", kmsg},
+		{"oom", &OOM{Kmsg: kmsg}},
+		{"psi", &Pressure{}},
+		{"load", &Load{}},
+		{"disk", &Disk{}},
+		{"diskio", &DiskIO{}},
+		{"net", &NetWork{}},
+		{"interrupts", &Interrupts{}},
+		{"cpuinfo", &CpuInventory{}},
+		{"cpufreq", &CpuFreq{}},
+		{"machine", &Machine{Kmsg: kmsg}},
+	} {
+		if err := registry.Register(c.name, c.collector); err != nil {
+			panic(err)
+		}
+	}
+	return registry
+}
@@ -0,0 +1,66 @@
+package system
+
+import (
+	"bytes"
+	"net"
+	"time"
+)
+
+//按行发送数据(InfluxDB line protocol、Graphite plaintext、StatsD等),
+//udp、unixgram每个包不超过MaxPacket字节且不拆分行, tcp直接写入
+type LineSender struct {
+	Network   string //udp, tcp, unixgram
+	Addr      string
+	MaxPacket int //udp、unixgram单个包的最大字节数
+	Timeout   time.Duration
+}
+
+func NewLineSender(network string, addr string) *LineSender {
+	return &LineSender{
+		Network: network,
+		Addr:    addr,
+		//以太网MTU 1500 - IP头20 - UDP头8
+		MaxPacket: 1472,
+		Timeout:   5 * time.Second,
+	}
+}
+
+func (this *LineSender) Send(data []byte) error {
+	conn, err := net.DialTimeout(this.Network, this.Addr, this.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(this.Timeout))
+	if this.Network == "tcp" || this.MaxPacket <= 0 {
+		_, err = conn.Write(data)
+		return err
+	}
+	for _, packet := range SplitLines(data, this.MaxPacket) {
+		_, err = conn.Write(packet)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//按行拼成不超过size字节的包, 单行超过size时单独成包
+func SplitLines(data []byte, size int) [][]byte {
+	packets := [][]byte{}
+	packet := []byte{}
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if len(packet) > 0 && len(packet)+len(line) > size {
+			packets = append(packets, packet)
+			packet = []byte{}
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+	return packets
+}
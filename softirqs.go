@@ -0,0 +1,251 @@
+package system
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SoftIrq struct {
+	Name   string   //类型, 如NET_RX、NET_TX、TIMER、BLOCK、SCHED、RCU
+	Counts []uint64 //从系统启动后累加的每个cpu软中断次数, 与SoftIrqs.Cpus顺序一致
+
+	//计算得出
+	PerSecond []float64 //一个周期每个cpu平均每秒软中断次数
+	Total     float64   //一个周期平均每秒软中断次数
+	MaxCpu    int       //处理次数最多的cpu编号
+	MaxShare  float64   //处理次数最多的cpu的占比(%)
+	Last      int64     //上次采集时间
+}
+
+//读/proc/softirqs, 按类型统计每个cpu上的软中断次数, 用于区分Cpu.SoftIrqRate升高是网络收包还是块设备完成等引起的
+type SoftIrqs struct {
+	SoftIrqMap   map[string]*SoftIrq //类型=>软中断
+	SoftIrqNames []string            //类型, 与文件中顺序一致
+	Cpus         []int               //cpu编号, 来自表头
+	ProcRoot     string              //procfs根目录, 为空时使用ProcRoot
+}
+
+func (this *SoftIrqs) Dump() {
+	for _, name := range this.SoftIrqNames {
+		softIrq := this.SoftIrqMap[name]
+		fmt.Printf("softirq:%s, total:%f, maxCpu:%d, maxShare:%f\n",
+			softIrq.Name,
+			softIrq.Total,
+			softIrq.MaxCpu,
+			softIrq.MaxShare)
+	}
+}
+
+func (this *SoftIrqs) Collect() error {
+	f, err := os.Open(ProcPath(this.ProcRoot, "softirqs"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if this.SoftIrqMap == nil {
+		this.SoftIrqMap = map[string]*SoftIrq{}
+	}
+	reader := bufio.NewReader(f)
+	//表头, 如CPU0 CPU1 CPU3
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	cpus := []int{}
+	for _, field := range strings.Fields(header) {
+		index, err := strconv.Atoi(strings.TrimPrefix(field, "CPU"))
+		if err != nil {
+			return errors.New("invalid softirqs header: " + header)
+		}
+		cpus = append(cpus, index)
+	}
+	//cpu上下线后列对不上, 按第一次采集处理
+	cpuChanged := len(cpus) != len(this.Cpus)
+	for i := 0; !cpuChanged && i < len(cpus); i++ {
+		cpuChanged = cpus[i] != this.Cpus[i]
+	}
+
+	now := time.Now().Unix()
+	names := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+		name := strings.TrimSuffix(fields[0], ":")
+		counts := make([]uint64, len(cpus))
+		for i := 0; i < len(cpus) && i+1 < len(fields); i++ {
+			counts[i], _ = strconv.ParseUint(fields[i+1], 10, 64)
+		}
+		softIrq, exists := this.SoftIrqMap[name]
+		if !exists {
+			softIrq = &SoftIrq{Name: name}
+			this.SoftIrqMap[name] = softIrq
+		}
+
+		perSecond := make([]float64, len(cpus))
+		var total float64
+		difftime := float64(now - softIrq.Last)
+		if softIrq.Last > 0 && !cpuChanged && len(softIrq.Counts) == len(counts) && difftime > 0 {
+			for i := range counts {
+				perSecond[i] = float64(CounterDiff(counts[i], softIrq.Counts[i])) / difftime
+				total += perSecond[i]
+			}
+		}
+		softIrq.Counts = counts
+		softIrq.PerSecond = perSecond
+		softIrq.Total = total
+		softIrq.MaxCpu = 0
+		softIrq.MaxShare = 0
+		if total > 0 {
+			max := 0
+			for i := range perSecond {
+				if perSecond[i] > perSecond[max] {
+					max = i
+				}
+			}
+			softIrq.MaxCpu = cpus[max]
+			softIrq.MaxShare = perSecond[max] / total * 100
+		}
+		softIrq.Last = now
+		names = append(names, name)
+	}
+	this.SoftIrqNames = names
+	this.Cpus = cpus
+	return nil
+}
+
+//按类型取软中断, 不区分大小写, 如net_rx
+func (this *SoftIrqs) GetSoftIrqByIndex(args string) (*SoftIrq, error) {
+	softIrq, exists := this.SoftIrqMap[strings.ToUpper(args)]
+	if !exists {
+		return nil, errors.New("softirq not found")
+	}
+	return softIrq, nil
+}
+
+//某类型软中断在某个cpu上平均每秒次数
+func (this *SoftIrqs) PerSecondByCpu(name string, cpu int) (float64, error) {
+	softIrq, err := this.GetSoftIrqByIndex(name)
+	if err != nil {
+		return 0, err
+	}
+	for i, index := range this.Cpus {
+		if index == cpu && i < len(softIrq.PerSecond) {
+			return softIrq.PerSecond[i], nil
+		}
+	}
+	return 0, errors.New("cpu not found")
+}
+
+//所有类型
+func (this *SoftIrqs) Names() []string {
+	return append([]string{}, this.SoftIrqNames...)
+}
+
+//所有类型与cpu的组合, 如NET_RX:cpu3
+func (this *SoftIrqs) TypeCpus() []string {
+	ret := []string{}
+	for _, name := range this.SoftIrqNames {
+		for _, index := range this.Cpus {
+			ret = append(ret, fmt.Sprintf("%s:cpu%d", name, index))
+		}
+	}
+	return ret
+}
+
+//平均每秒软中断次数
+func (this *SoftIrqs) SoftIrqPerSecondFunc(args string) string {
+	softIrq, err := this.GetSoftIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return FloatToString(softIrq.Total)
+}
+
+//累计软中断次数
+func (this *SoftIrqs) SoftIrqCountFunc(args string) string {
+	softIrq, err := this.GetSoftIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	var count uint64
+	for _, c := range softIrq.Counts {
+		count += c
+	}
+	return strconv.FormatUint(count, 10)
+}
+
+//处理次数最多的cpu编号
+func (this *SoftIrqs) SoftIrqMaxCpuFunc(args string) string {
+	softIrq, err := this.GetSoftIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return strconv.Itoa(softIrq.MaxCpu)
+}
+
+//处理次数最多的cpu的占比
+func (this *SoftIrqs) SoftIrqMaxShareFunc(args string) string {
+	softIrq, err := this.GetSoftIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	return FloatToString(softIrq.MaxShare)
+}
+
+//某类型软中断在某个cpu上平均每秒次数, args为类型:cpu编号, 如NET_RX:cpu3, 也可传net_rx:3
+func (this *SoftIrqs) SoftIrqCpuPerSecondFunc(args string) string {
+	pos := strings.LastIndex(args, ":")
+	if pos < 0 {
+		return ""
+	}
+	cpu, err := strconv.Atoi(strings.TrimPrefix(args[pos+1:], "cpu"))
+	if err != nil {
+		return ""
+	}
+	perSecond, err := this.PerSecondByCpu(args[:pos], cpu)
+	if err != nil {
+		return ""
+	}
+	return FloatToString(perSecond)
+}
+
+//每个cpu平均每秒软中断次数, 如cpu0:1200.00,cpu1:35.50
+func (this *SoftIrqs) SoftIrqCpuSetFunc(args string) string {
+	softIrq, err := this.GetSoftIrqByIndex(args)
+	if err != nil {
+		return ""
+	}
+	ret := []string{}
+	for i, index := range this.Cpus {
+		if i < len(softIrq.PerSecond) {
+			ret = append(ret, fmt.Sprintf("cpu%d:%s", index, FloatToString(softIrq.PerSecond[i])))
+		}
+	}
+	return strings.Join(ret, ",")
+}
+
+func (this *SoftIrqs) Metrics() []*Metric {
+	return []*Metric{
+		{Key: "softirq.avg", Unit: "1/s", Type: GAUGE, Desc: "每秒软中断次数", Label: "type", Args: this.Names, Func: this.SoftIrqPerSecondFunc},
+		{Key: "softirq.count", Type: COUNTER, Desc: "软中断次数", Label: "type", Args: this.Names, Func: this.SoftIrqCountFunc},
+		{Key: "softirq.max.cpu", Type: GAUGE, Desc: "处理次数最多的cpu编号", Label: "type", Args: this.Names, Func: this.SoftIrqMaxCpuFunc},
+		{Key: "softirq.max.share", Unit: "%", Type: GAUGE, Desc: "处理次数最多的cpu的占比", Label: "type", Args: this.Names, Func: this.SoftIrqMaxShareFunc},
+		{Key: "softirq.cpu.avg", Unit: "1/s", Type: GAUGE, Desc: "某类型软中断在某个cpu上每秒次数", Label: "type_cpu", Args: this.TypeCpus, Func: this.SoftIrqCpuPerSecondFunc},
+		{Key: "softirq.cpu.set", Type: TEXT, Desc: "每个cpu每秒软中断次数", Label: "type", Args: this.Names, Func: this.SoftIrqCpuSetFunc},
+	}
+}
@@ -0,0 +1,46 @@
+package system
+
+import (
+	"testing"
+)
+
+func TestSoftIrqCpuPerSecond(t *testing.T) {
+	s := &SoftIrqs{ProcRoot: goldenProcRoot("kernel-6.8", "1")}
+	registry := NewRegistry()
+	if err := registry.Register("softirqs", s); err != nil {
+		t.Fatal(err)
+	}
+	registry.Collect()
+	for _, softIrq := range s.SoftIrqMap {
+		softIrq.Last -= goldenInterval
+	}
+	s.ProcRoot = goldenProcRoot("kernel-6.8", "2")
+	registry.Collect()
+
+	values := map[string]string{}
+	for _, sample := range registry.Samples() {
+		if sample.Metric.Key == "softirq.cpu.avg" {
+			values[sample.Arg] = sample.Value
+		}
+	}
+	if len(values) != len(s.SoftIrqNames)*len(s.Cpus) {
+		t.Errorf("got %d samples, want %d", len(values), len(s.SoftIrqNames)*len(s.Cpus))
+	}
+	//NET_RX全部在cpu0上
+	cases := map[string]string{
+		"NET_RX:cpu0": "2000.00",
+		"NET_RX:cpu3": "0",
+		"TIMER:cpu1":  "250.00",
+		"RCU:cpu7":    "150.00",
+	}
+	for arg, want := range cases {
+		if values[arg] != want {
+			t.Errorf("softirq.cpu.avg[%s] = %s, want %s", arg, values[arg], want)
+		}
+	}
+	for arg, want := range map[string]string{"net_rx:0": "2000.00", "NET_RX": "", "NET_RX:cpu99": ""} {
+		if got := s.SoftIrqCpuPerSecondFunc(arg); got != want {
+			t.Errorf("SoftIrqCpuPerSecondFunc(%s) = %s, want %s", arg, got, want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package system
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//向StatsD/DogStatsD发送一次采集的所有GAUGE类型指标, 通过udp或unixgram按包大小批量发送
+type StatsdEmitter struct {
+	Sender    *LineSender
+	Prefix    string   //指标名前缀, 如system
+	DogStatsd bool     //DogStatsD时分区、挂载点、网卡作为tag, 否则拼到指标名中
+	Tags      []string //DogStatsD公共tag, 如env:prod
+}
+
+//network为udp或unixgram, 如NewStatsdEmitter("udp", "127.0.0.1:8125", true)
+func NewStatsdEmitter(network string, addr string, dogstatsd bool) *StatsdEmitter {
+	sender := NewLineSender(network, addr)
+	if network == "unixgram" {
+		//DogStatsD unix socket默认的包大小
+		sender.MaxPacket = 8192
+	}
+	return &StatsdEmitter{Sender: sender, DogStatsd: dogstatsd}
+}
+
+func (this *StatsdEmitter) Emit(samples []Sample) error {
+	data := StatsdLines(this.Prefix, samples, this.DogStatsd, this.Tags)
+	if len(data) == 0 {
+		return nil
+	}
+	return this.Sender.Send(data)
+}
+
+//每个GAUGE类型指标一行: 名称:值|g, DogStatsD时追加|#tag:值,..., 非数值及NaN/Inf跳过
+func StatsdLines(prefix string, samples []Sample, dogstatsd bool, tags []string) []byte {
+	buf := bytes.Buffer{}
+	for _, sample := range samples {
+		m := sample.Metric
+		if m.Type != GAUGE {
+			continue
+		}
+		value, err := strconv.ParseFloat(sample.Value, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		name := m.Key
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		lineTags := tags
+		if m.Label != "" && sample.Arg != "" {
+			if dogstatsd {
+				lineTags = append(append([]string{}, tags...), m.Label+":"+sample.Arg)
+			} else {
+				name += "." + GraphiteNode(sample.Arg)
+			}
+		}
+		buf.WriteString(escapeStatsd(name) + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|g")
+		if dogstatsd && len(lineTags) > 0 {
+			escaped := []string{}
+			for _, tag := range lineTags {
+				escaped = append(escaped, strings.NewReplacer(",", "_", "|", "_", "\n", "_").Replace(tag))
+			}
+			buf.WriteString("|#" + strings.Join(escaped, ","))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+//指标名中不能出现:|@
+func escapeStatsd(name string) string {
+	return strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_").Replace(name)
+}
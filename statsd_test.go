@@ -0,0 +1,132 @@
+package system
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func statsdTestSamples() []Sample {
+	gauge := &Metric{Key: "cpu.idle", Type: GAUGE}
+	parti := &Metric{Key: "disk.io.util", Type: GAUGE, Label: "device"}
+	mount := &Metric{Key: "disk.mount.used.rate", Type: GAUGE, Label: "mount"}
+	ifi := &Metric{Key: "net.if.recv.bytes", Type: GAUGE, Label: "interface"}
+	counter := &Metric{Key: "cpu.switches", Type: COUNTER}
+	return []Sample{
+		{Metric: gauge, Value: "50.5"},
+		{Metric: parti, Arg: "sda1", Value: "25"},
+		{Metric: mount, Arg: "/", Value: "60"},
+		{Metric: mount, Arg: "/data/logs", Value: "70"},
+		{Metric: ifi, Arg: "eth0.100", Value: "1024"},
+		{Metric: counter, Value: "100"},
+		{Metric: gauge, Value: ""},
+		{Metric: gauge, Value: "NaN"},
+		{Metric: gauge, Value: "+Inf"},
+		{Metric: gauge, Value: "-Inf"},
+	}
+}
+
+func TestStatsdLines(t *testing.T) {
+	cases := []struct {
+		dogstatsd bool
+		tags      []string
+		want      string
+	}{
+		{false, []string{"env:prod"}, "system.cpu.idle:50.5|g\n" +
+			"system.disk.io.util.sda1:25|g\n" +
+			"system.disk.mount.used.rate._root:60|g\n" +
+			"system.disk.mount.used.rate.data_logs:70|g\n" +
+			"system.net.if.recv.bytes.eth0_100:1024|g\n"},
+		{true, []string{"env:prod"}, "system.cpu.idle:50.5|g|#env:prod\n" +
+			"system.disk.io.util:25|g|#env:prod,device:sda1\n" +
+			"system.disk.mount.used.rate:60|g|#env:prod,mount:/\n" +
+			"system.disk.mount.used.rate:70|g|#env:prod,mount:/data/logs\n" +
+			"system.net.if.recv.bytes:1024|g|#env:prod,interface:eth0.100\n"},
+		{true, nil, "system.cpu.idle:50.5|g\n" +
+			"system.disk.io.util:25|g|#device:sda1\n" +
+			"system.disk.mount.used.rate:60|g|#mount:/\n" +
+			"system.disk.mount.used.rate:70|g|#mount:/data/logs\n" +
+			"system.net.if.recv.bytes:1024|g|#interface:eth0.100\n"},
+	}
+	for _, c := range cases {
+		got := string(StatsdLines("system", statsdTestSamples(), c.dogstatsd, c.tags))
+		if got != c.want {
+			t.Errorf("StatsdLines(dogstatsd=%v, tags=%v) = %q, want %q", c.dogstatsd, c.tags, got, c.want)
+		}
+	}
+}
+
+//读取want个包, 5秒内未收到则测试失败
+func readStatsdPackets(t *testing.T, conn net.PacketConn, want int) []string {
+	packets := []string{}
+	buf := make([]byte, 65536)
+	for len(packets) < want {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("got %d packets, want %d: %v", len(packets), want, err)
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+	return packets
+}
+
+func TestStatsdEmitter(t *testing.T) {
+	samples := []Sample{}
+	for i := 0; i < 20; i++ {
+		m := &Metric{Key: "disk.mount.used.rate", Type: GAUGE, Label: "mount"}
+		samples = append(samples, Sample{Metric: m, Arg: fmt.Sprintf("/data%d", i), Value: "50"})
+	}
+	dir := t.TempDir()
+	cases := []struct {
+		network string
+		addr    string
+	}{
+		{"udp", "127.0.0.1:0"},
+		{"unixgram", filepath.Join(dir, "dsd.socket")},
+	}
+	for _, c := range cases {
+		t.Run(c.network, func(t *testing.T) {
+			conn, err := net.ListenPacket(c.network, c.addr)
+			if err != nil {
+				t.Skip(err)
+			}
+			defer conn.Close()
+
+			emitter := NewStatsdEmitter(c.network, conn.LocalAddr().String(), true)
+			emitter.Prefix = "system"
+			emitter.Tags = []string{"env:prod"}
+			//每行约60字节, 每个包最多3行
+			emitter.Sender.MaxPacket = 200
+			data := StatsdLines(emitter.Prefix, samples, true, emitter.Tags)
+			want := SplitLines(data, emitter.Sender.MaxPacket)
+			if len(want) < 2 {
+				t.Fatalf("got %d packets, want batching", len(want))
+			}
+			if err := emitter.Emit(samples); err != nil {
+				t.Fatal(err)
+			}
+
+			packets := readStatsdPackets(t, conn, len(want))
+			for _, packet := range packets {
+				if len(packet) > emitter.Sender.MaxPacket {
+					t.Errorf("packet size %d > %d", len(packet), emitter.Sender.MaxPacket)
+				}
+				//不拆分行
+				if !strings.HasSuffix(packet, "\n") {
+					t.Errorf("packet %q not end with newline", packet)
+				}
+			}
+			if got := strings.Join(packets, ""); got != string(data) {
+				t.Errorf("got %q, want %q", got, data)
+			}
+			if !bytes.Contains(data, []byte("system.disk.mount.used.rate:50|g|#env:prod,mount:/data19\n")) {
+				t.Errorf("unexpected data %q", data)
+			}
+		})
+	}
+}
@@ -2,12 +2,47 @@ package system
 
 import (
 	"io/ioutil"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
+//procfs、sysfs根目录, 容器中挂载宿主机/proc时可设为/host/proc, 测试时可指向采集好的快照目录
+//各采集器的ProcRoot、SysRoot字段不为空时优先使用字段
+var (
+	ProcRoot = "/proc"
+	SysRoot  = "/sys"
+)
+
+//返回procfs下的文件路径, root为空时使用ProcRoot
+func ProcPath(root string, name ...string) string {
+	if root == "" {
+		root = ProcRoot
+	}
+	return filepath.Join(append([]string{root}, name...)...)
+}
+
+//取当前时间, now为空时使用time.Now; 采集器的Now字段用于快照及测试时固定两次采集的时间差
+func currentTime(now func() time.Time) time.Time {
+	if now == nil {
+		return time.Now()
+	}
+	return now()
+}
+
+//返回sysfs下的文件路径, root为空时使用SysRoot
+func SysPath(root string, name ...string) string {
+	if root == "" {
+		root = SysRoot
+	}
+	return filepath.Join(append([]string{root}, name...)...)
+}
+
+//通过sh -c执行命令, 库内所有指标均已直接读取/proc、/sys, 不再调用, 仅供调用方显式使用
 func Exec(cmd string) (string, error) {
 	command := exec.Command("sh", "-c", cmd)
 	bytes, err := command.Output()
@@ -28,6 +63,14 @@ func ExecOutput(cmd string) string {
 	return output
 }
 
+//计数器差值, 计数器回绕或重置(如iowait回退、驱动重新加载)时当前值小于上次值, 返回0
+func CounterDiff(cur uint64, last uint64) uint64 {
+	if cur < last {
+		return 0
+	}
+	return cur - last
+}
+
 func FloatToString(f float64) string {
 	if f == 0 {
 		//0.00 => 0 减少带宽占用
@@ -36,6 +79,14 @@ func FloatToString(f float64) string {
 	return strconv.FormatFloat(f, 'f', 2, 64)
 }
 
+//按awk print的格式输出数字, 整数不带小数, 其余保留6位有效数字
+func AwkNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', 6, 64)
+}
+
 func GetFileContent(filePath string) (string, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -0,0 +1,158 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//需要计算速率的计数, 按zone统计的(如pgscan_kswapd_normal)合并计算
+type vmstatCounter struct {
+	Name string //vmstat中的名称
+	Key  string //指标key
+	Unit string
+	Desc string
+}
+
+var vmstatCounters = []vmstatCounter{
+	{"pgpgin", "vmstat.pgpgin.avg", "kb/s", "每秒从磁盘读入的数据量"},
+	{"pgpgout", "vmstat.pgpgout.avg", "kb/s", "每秒写出到磁盘的数据量"},
+	{"pswpin", "vmstat.pswpin.avg", "1/s", "每秒换入的页数"},
+	{"pswpout", "vmstat.pswpout.avg", "1/s", "每秒换出的页数"},
+	{"pgfault", "vmstat.pgfault.avg", "1/s", "每秒缺页次数"},
+	{"pgmajfault", "vmstat.pgmajfault.avg", "1/s", "每秒需要读磁盘的缺页次数"},
+	{"pgscan_direct", "vmstat.pgscan.direct.avg", "1/s", "每秒直接回收扫描的页数"},
+	{"pgscan_kswapd", "vmstat.pgscan.kswapd.avg", "1/s", "每秒kswapd扫描的页数"},
+	{"pgsteal_direct", "vmstat.pgsteal.direct.avg", "1/s", "每秒直接回收的页数"},
+	{"pgsteal_kswapd", "vmstat.pgsteal.kswapd.avg", "1/s", "每秒kswapd回收的页数"},
+	{"allocstall", "vmstat.allocstall.avg", "1/s", "每秒因内存不足进入直接回收的次数"},
+	{"compact_stall", "vmstat.compact.stall.avg", "1/s", "每秒因内存碎片进入直接规整的次数"},
+	{"thp_fault_alloc", "vmstat.thp.fault.alloc.avg", "1/s", "每秒缺页时分配透明大页的次数"},
+	{"oom_kill", "vmstat.oom.kill.avg", "1/s", "每秒OOM杀进程次数"},
+}
+
+//3.x内核按zone统计回收, 4.8以后allocstall按zone统计
+var vmstatZones = []string{"dma", "dma32", "normal", "highmem", "movable", "device"}
+
+//读/proc/vmstat, 计算换页、缺页、内存回收等每秒速率
+type VMStat struct {
+	Counters  map[string]uint64  //vmstat所有计数
+	Keys      []string           //vmstat所有名称, 与文件中顺序一致
+	Rates     map[string]float64 //vmstatCounters中的名称=>一个周期平均每秒次数, 内核没有该计数时不存在
+	RateNames []string           //内核支持的vmstatCounters中的名称
+	Last      int64              //上次采集时间
+	ProcRoot  string             //procfs根目录, 为空时使用ProcRoot
+
+	last map[string]uint64 //上次采集的合并计数
+}
+
+func (this *VMStat) Dump() {
+	for _, name := range this.RateNames {
+		count, _ := this.Counter(name)
+		fmt.Printf("%s count:%d, perSecond:%f\n", name, count, this.Rates[name])
+	}
+}
+
+func (this *VMStat) Collect() error {
+	content, err := GetFileContent(ProcPath(this.ProcRoot, "vmstat"))
+	if err != nil {
+		return err
+	}
+	counters := map[string]uint64{}
+	keys := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, exists := counters[fields[0]]; !exists {
+			keys = append(keys, fields[0])
+		}
+		counters[fields[0]] = value
+	}
+	if len(counters) == 0 {
+		return errors.New("invalid vmstat")
+	}
+	this.Counters = counters
+	this.Keys = keys
+
+	now := time.Now().Unix()
+	difftime := float64(now - this.Last)
+	last := map[string]uint64{}
+	rates := map[string]float64{}
+	names := []string{}
+	for _, counter := range vmstatCounters {
+		count, exists := this.Counter(counter.Name)
+		if !exists {
+			continue
+		}
+		var rate float64
+		lastCount, lastExists := this.last[counter.Name]
+		if lastExists && this.Last > 0 && difftime > 0 {
+			rate = float64(CounterDiff(count, lastCount)) / difftime
+		}
+		last[counter.Name] = count
+		rates[counter.Name] = rate
+		names = append(names, counter.Name)
+	}
+	this.last = last
+	this.Rates = rates
+	this.RateNames = names
+	this.Last = now
+	return nil
+}
+
+//取vmstat中的计数, 同时累加按zone统计的计数, 如pgscan_kswapd包含pgscan_kswapd_normal
+func (this *VMStat) Counter(name string) (uint64, bool) {
+	count, exists := this.Counters[name]
+	for _, zone := range vmstatZones {
+		if value, ok := this.Counters[name+"_"+zone]; ok {
+			count += value
+			exists = true
+		}
+	}
+	return count, exists
+}
+
+//一个周期平均每秒次数
+func (this *VMStat) GetRate(name string) (float64, error) {
+	rate, exists := this.Rates[name]
+	if !exists {
+		return 0, errors.New("vmstat counter not found: " + name)
+	}
+	return rate, nil
+}
+
+//vmstat中任意计数, 内核没有该计数时返回空
+func (this *VMStat) CounterFunc(args string) string {
+	count, exists := this.Counter(args)
+	if !exists {
+		return ""
+	}
+	return strconv.FormatUint(count, 10)
+}
+
+func (this *VMStat) rateFunc(name string) MetricFunc {
+	return func(args string) string {
+		rate, err := this.GetRate(name)
+		if err != nil {
+			return ""
+		}
+		return FloatToString(rate)
+	}
+}
+
+func (this *VMStat) Metrics() []*Metric {
+	metrics := []*Metric{}
+	for _, counter := range vmstatCounters {
+		metrics = append(metrics, &Metric{Key: counter.Key, Unit: counter.Unit, Type: GAUGE, Desc: counter.Desc, Func: this.rateFunc(counter.Name)})
+	}
+	metrics = append(metrics, &Metric{Key: "vmstat.count", Type: COUNTER, Desc: "vmstat中任意计数", Label: "counter", Func: this.CounterFunc})
+	return metrics
+}
@@ -0,0 +1,109 @@
+package system
+
+import (
+	"testing"
+)
+
+//依次采集两次快照, 间隔goldenInterval秒
+func collectGoldenVMStat(t *testing.T, v *VMStat, first string, second string) {
+	v.ProcRoot = first
+	if err := v.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	v.Last -= goldenInterval
+	v.ProcRoot = second
+	if err := v.Collect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVMStatRate(t *testing.T) {
+	//kernel-3.10按zone统计pgscan、pgsteal, 4.8以后allocstall按zone统计, 合并后速率相同
+	want := map[string]float64{
+		"pgpgin":          80,
+		"pgpgout":         400,
+		"pswpin":          5,
+		"pswpout":         20,
+		"pgfault":         3000,
+		"pgmajfault":      2,
+		"pgscan_kswapd":   500,
+		"pgscan_direct":   50,
+		"pgsteal_kswapd":  450,
+		"pgsteal_direct":  40,
+		"allocstall":      1,
+		"compact_stall":   0.5,
+		"thp_fault_alloc": 3,
+		"oom_kill":        0.1,
+	}
+	for _, k := range goldenKernels {
+		t.Run(k.name, func(t *testing.T) {
+			v := &VMStat{}
+			collectGoldenVMStat(t, v, goldenProcRoot(k.name, "1"), goldenProcRoot(k.name, "2"))
+			for name, rate := range want {
+				got, err := v.GetRate(name)
+				if name == "oom_kill" && k.name == "kernel-3.10" {
+					//老内核没有oom_kill
+					if err == nil {
+						t.Errorf("GetRate(oom_kill) = %f, want error", got)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("GetRate(%s): %v", name, err)
+					continue
+				}
+				assertFloat(t, name, got, rate, 0.000001)
+			}
+		})
+	}
+}
+
+func TestVMStatZoneCounter(t *testing.T) {
+	cases := []struct {
+		kernel string
+		name   string
+		count  string
+	}{
+		//pgscan_kswapd_dma32 + pgscan_kswapd_normal
+		{"kernel-3.10", "pgscan_kswapd", "130000"},
+		{"kernel-3.10", "pgscan_direct", "6500"},
+		{"kernel-4.18", "pgscan_kswapd", "130000"},
+		{"kernel-4.18", "pgscan_direct", "6500"},
+		//allocstall_normal + allocstall_movable
+		{"kernel-4.18", "allocstall", "310"},
+		{"kernel-3.10", "allocstall", "310"},
+		{"kernel-3.10", "oom_kill", ""},
+	}
+	for _, c := range cases {
+		v := &VMStat{ProcRoot: goldenProcRoot(c.kernel, "2")}
+		if err := v.Collect(); err != nil {
+			t.Fatal(err)
+		}
+		if got := v.CounterFunc(c.name); got != c.count {
+			t.Errorf("%s CounterFunc(%s) = %s, want %s", c.kernel, c.name, got, c.count)
+		}
+	}
+}
+
+//计数器小于上次值(重置)时速率为0, 不会因无符号相减溢出
+func TestVMStatCounterReset(t *testing.T) {
+	v := &VMStat{}
+	collectGoldenVMStat(t, v, goldenProcRoot("kernel-6.8", "2"), goldenProcRoot("kernel-6.8", "1"))
+	for _, name := range []string{"pswpin", "pgscan_direct", "allocstall"} {
+		got, err := v.GetRate(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertFloat(t, name, got, 0, 0)
+	}
+	//重置后下一个周期恢复正常
+	v.Last -= goldenInterval
+	v.ProcRoot = goldenProcRoot("kernel-6.8", "2")
+	if err := v.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	for name, rate := range map[string]float64{"pswpin": 5, "pgscan_direct": 50, "allocstall": 1} {
+		got, _ := v.GetRate(name)
+		assertFloat(t, name, got, rate, 0.000001)
+	}
+}
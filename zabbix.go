@@ -0,0 +1,416 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ZabbixNotSupported = "ZBX_NOTSUPPORTED"
+	zabbixMaxDataLen   = 16 * 1024 * 1024
+)
+
+//Zabbix agent, 被动模式下监听10050端口响应server的item查询, 主动模式下向server拉取检查项并上报,
+//item key即注册表中的指标key, 参数写在[]中, 如disk.mount.used.rate[/data]
+type ZabbixAgent struct {
+	Registry      *Registry
+	Hostname      string        //主动模式上报的主机名, 为空时使用系统主机名
+	Interval      time.Duration //采集间隔
+	Timeout       time.Duration //单次连接读写超时
+	RefreshActive time.Duration //主动模式重新拉取检查项的间隔
+
+	lock      sync.Mutex
+	listener  net.Listener
+	stop      chan struct{}
+	started   bool
+	closeOnce sync.Once
+}
+
+func NewZabbixAgent(registry *Registry) *ZabbixAgent {
+	return &ZabbixAgent{
+		Registry:      registry,
+		Interval:      time.Minute,
+		Timeout:       3 * time.Second,
+		RefreshActive: 2 * time.Minute,
+		stop:          make(chan struct{}),
+	}
+}
+
+//按key查询指标值, 第二个返回值为false时表示不支持, 第一个返回值为错误信息
+func (this *ZabbixAgent) Query(itemKey string) (string, bool) {
+	name, params, err := ParseZabbixKey(itemKey)
+	if err != nil {
+		return err.Error(), false
+	}
+	switch name {
+	case "agent.ping":
+		return "1", true
+	case "agent.hostname":
+		return this.hostname(), true
+	}
+	m, exists := this.Registry.Metric(name)
+	if !exists {
+		return "Unsupported item key.", false
+	}
+	if len(params) > 1 {
+		return "Too many parameters.", false
+	}
+	args := ""
+	if len(params) == 1 {
+		args = params[0]
+	}
+	if m.Label != "" && args == "" {
+		return "Invalid first parameter.", false
+	}
+	value, _ := this.Registry.Get(name, args)
+	if value == "" {
+		return "Cannot obtain information.", false
+	}
+	return value, true
+}
+
+//被动模式, 监听addr并阻塞直到Close
+func (this *ZabbixAgent) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return this.Serve(listener)
+}
+
+func (this *ZabbixAgent) Serve(listener net.Listener) error {
+	this.lock.Lock()
+	this.listener = listener
+	this.lock.Unlock()
+	this.startCollect()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-this.stop:
+				return nil
+			default:
+			}
+			return err
+		}
+		go this.handle(conn)
+	}
+}
+
+//停止被动模式监听、主动模式上报以及定时采集, 多次调用只关闭一次
+func (this *ZabbixAgent) Close() error {
+	var err error
+	this.closeOnce.Do(func() {
+		this.lock.Lock()
+		defer this.lock.Unlock()
+		close(this.stop)
+		if this.listener != nil {
+			err = this.listener.Close()
+		}
+	})
+	return err
+}
+
+func (this *ZabbixAgent) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(this.Timeout))
+	request, err := ReadZabbixPacket(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+	itemKey := strings.TrimSpace(string(request))
+	value, ok := this.Query(itemKey)
+	var response []byte
+	if ok {
+		response = []byte(value)
+	} else {
+		//ZBX_NOTSUPPORTED\0错误信息
+		response = append([]byte(ZabbixNotSupported+"\x00"), value...)
+	}
+	WriteZabbixPacket(conn, response)
+}
+
+//启动定时采集, 多次调用只启动一次
+func (this *ZabbixAgent) startCollect() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.started {
+		return
+	}
+	this.started = true
+	this.Registry.Collect()
+	go func() {
+		ticker := time.NewTicker(this.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-this.stop:
+				return
+			case <-ticker.C:
+				this.Registry.Collect()
+			}
+		}
+	}()
+}
+
+func (this *ZabbixAgent) hostname() string {
+	if this.Hostname != "" {
+		return this.Hostname
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+//主动模式检查项
+type zabbixCheck struct {
+	Key   string      `json:"key"`
+	Delay interface{} `json:"delay"` //老版本为秒数, 新版本为字符串, 如30s, 1m
+	next  time.Time
+}
+
+type zabbixValue struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	State int    `json:"state,omitempty"` //1表示不支持
+	Clock int64  `json:"clock"`
+	Ns    int64  `json:"ns"`
+	Id    int64  `json:"id"`
+}
+
+//主动模式, 定期从server(如127.0.0.1:10051)拉取检查项, 按各检查项的间隔采集并上报, 阻塞直到Close;
+//第一次拉取检查项失败时直接返回错误, 不启动定时采集
+func (this *ZabbixAgent) RunActive(server string) error {
+	checks, err := this.activeChecks(server)
+	if err != nil {
+		return err
+	}
+	this.startCollect()
+	refresh := time.Now().Add(this.RefreshActive)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var id int64
+	for {
+		select {
+		case <-this.stop:
+			return nil
+		case now := <-ticker.C:
+			if now.After(refresh) {
+				//拉取失败时继续使用原检查项
+				if newChecks, err := this.activeChecks(server); err == nil {
+					checks = newChecks
+				}
+				refresh = now.Add(this.RefreshActive)
+			}
+			values := []zabbixValue{}
+			for _, check := range checks {
+				//留半秒余量, 避免定时器抖动导致多等一个周期
+				if now.Add(time.Second / 2).Before(check.next) {
+					continue
+				}
+				check.next = now.Add(zabbixDelay(check.Delay))
+				value, ok := this.Query(check.Key)
+				id++
+				v := zabbixValue{Host: this.hostname(), Key: check.Key, Value: value, Clock: now.Unix(), Ns: int64(now.Nanosecond()), Id: id}
+				if !ok {
+					v.State = 1
+				}
+				values = append(values, v)
+			}
+			if len(values) > 0 {
+				this.sendActive(server, values)
+			}
+		}
+	}
+}
+
+func (this *ZabbixAgent) activeChecks(server string) ([]*zabbixCheck, error) {
+	request := map[string]string{"request": "active checks", "host": this.hostname()}
+	var response struct {
+		Response string         `json:"response"`
+		Info     string         `json:"info"`
+		Data     []*zabbixCheck `json:"data"`
+	}
+	err := this.exchange(server, request, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Response != "success" {
+		return nil, errors.New("active checks failed: " + response.Info)
+	}
+	return response.Data, nil
+}
+
+func (this *ZabbixAgent) sendActive(server string, values []zabbixValue) error {
+	now := time.Now()
+	request := map[string]interface{}{
+		"request": "agent data",
+		"data":    values,
+		"clock":   now.Unix(),
+		"ns":      now.Nanosecond(),
+	}
+	var response struct {
+		Response string `json:"response"`
+		Info     string `json:"info"`
+	}
+	err := this.exchange(server, request, &response)
+	if err != nil {
+		return err
+	}
+	if response.Response != "success" {
+		return errors.New("agent data failed: " + response.Info)
+	}
+	return nil
+}
+
+//主动模式每次请求一个连接
+func (this *ZabbixAgent) exchange(server string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", server, this.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(this.Timeout))
+	err = WriteZabbixPacket(conn, body)
+	if err != nil {
+		return err
+	}
+	data, err := ReadZabbixPacket(bufio.NewReader(conn))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, response)
+}
+
+//检查项间隔, 支持秒数及s、m、h、d、w后缀, 解析失败时使用60秒
+func zabbixDelay(delay interface{}) time.Duration {
+	var str string
+	switch v := delay.(type) {
+	case float64:
+		return time.Duration(v) * time.Second
+	case string:
+		str = strings.TrimSpace(v)
+	}
+	units := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	unit := time.Second
+	if len(str) > 0 {
+		if u, exists := units[str[len(str)-1]]; exists {
+			unit = u
+			str = str[:len(str)-1]
+		}
+	}
+	n, err := strconv.Atoi(str)
+	if err != nil || n <= 0 {
+		return time.Minute
+	}
+	return time.Duration(n) * unit
+}
+
+//解析item key, 如disk.mount.used.rate[/data]返回disk.mount.used.rate和["/data"], 参数支持双引号
+func ParseZabbixKey(itemKey string) (string, []string, error) {
+	pos := strings.Index(itemKey, "[")
+	if pos < 0 {
+		return itemKey, nil, nil
+	}
+	if !strings.HasSuffix(itemKey, "]") {
+		return "", nil, errors.New("Invalid item key format.")
+	}
+	name := itemKey[:pos]
+	content := itemKey[pos+1 : len(itemKey)-1]
+	params := []string{}
+	param := bytes.Buffer{}
+	quoted := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(content) && content[i+1] == '"':
+			param.WriteByte('"')
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			params = append(params, strings.TrimSpace(param.String()))
+			param.Reset()
+		default:
+			param.WriteByte(c)
+		}
+	}
+	if quoted {
+		return "", nil, errors.New("Invalid item key format.")
+	}
+	params = append(params, strings.TrimSpace(param.String()))
+	if len(params) == 1 && params[0] == "" {
+		params = nil
+	}
+	return name, params, nil
+}
+
+//写一个数据包: ZBXD + 标志位0x01 + 4字节数据长度 + 4字节保留, 均为小端
+func WriteZabbixPacket(w io.Writer, data []byte) error {
+	header := make([]byte, 13)
+	copy(header, "ZBXD\x01")
+	binary.LittleEndian.PutUint32(header[5:9], uint32(len(data)))
+	_, err := w.Write(append(header, data...))
+	return err
+}
+
+//读一个数据包, 兼容老版本server不带ZBXD头、以换行结束的请求
+func ReadZabbixPacket(r *bufio.Reader) ([]byte, error) {
+	prefix, err := r.Peek(4)
+	if err != nil && len(prefix) == 0 {
+		return nil, err
+	}
+	if string(prefix) != "ZBXD" {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return []byte(line), nil
+	}
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	flags := header[4]
+	if flags&0x02 != 0 {
+		return nil, errors.New("compressed zabbix packet not supported")
+	}
+	//0x04为大包, 长度字段为8字节
+	lenSize := 4
+	if flags&0x04 != 0 {
+		lenSize = 8
+	}
+	lens := make([]byte, lenSize*2)
+	if _, err := io.ReadFull(r, lens); err != nil {
+		return nil, err
+	}
+	var dataLen uint64
+	if lenSize == 4 {
+		dataLen = uint64(binary.LittleEndian.Uint32(lens[:4]))
+	} else {
+		dataLen = binary.LittleEndian.Uint64(lens[:8])
+	}
+	if dataLen > zabbixMaxDataLen {
+		return nil, fmt.Errorf("zabbix packet too large: %d", dataLen)
+	}
+	data := make([]byte, dataLen)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,218 @@
+package system
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+//测试用采集器, 指标值固定
+type testCollector struct {
+	lock    sync.Mutex
+	collect int
+	metrics []*Metric
+}
+
+func (this *testCollector) Collect() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.collect++
+	return nil
+}
+
+func (this *testCollector) Dump() {}
+
+func (this *testCollector) Metrics() []*Metric {
+	return this.metrics
+}
+
+func (this *testCollector) collectTimes() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.collect
+}
+
+func newTestRegistry(t *testing.T) (*Registry, *testCollector) {
+	c := &testCollector{metrics: []*Metric{
+		{Key: "test.value", Type: GAUGE, Func: func(args string) string { return "42" }},
+		{Key: "test.disk", Type: GAUGE, Label: "device", Args: func() []string { return []string{"sda"} }, Func: func(args string) string { return args + "-1" }},
+	}}
+	registry := NewRegistry()
+	if err := registry.Register("test", c); err != nil {
+		t.Fatal(err)
+	}
+	return registry, c
+}
+
+//代替zabbix server, 响应active checks并记录上报的数据
+type zabbixStubServer struct {
+	listener net.Listener
+	checks   []*zabbixCheck
+	fail     bool
+	values   chan zabbixValue
+}
+
+func newZabbixStubServer(t *testing.T, checks []*zabbixCheck, fail bool) *zabbixStubServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &zabbixStubServer{listener: listener, checks: checks, fail: fail, values: make(chan zabbixValue, 100)}
+	go server.serve()
+	return server
+}
+
+func (this *zabbixStubServer) serve() {
+	for {
+		conn, err := this.listener.Accept()
+		if err != nil {
+			return
+		}
+		go this.handle(conn)
+	}
+}
+
+func (this *zabbixStubServer) handle(conn net.Conn) {
+	defer conn.Close()
+	data, err := ReadZabbixPacket(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+	var request struct {
+		Request string        `json:"request"`
+		Data    []zabbixValue `json:"data"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return
+	}
+	response := map[string]interface{}{"response": "success"}
+	switch {
+	case this.fail:
+		response = map[string]interface{}{"response": "failed", "info": "host not found"}
+	case request.Request == "active checks":
+		response["data"] = this.checks
+	case request.Request == "agent data":
+		for _, v := range request.Data {
+			this.values <- v
+		}
+	}
+	body, _ := json.Marshal(response)
+	WriteZabbixPacket(conn, body)
+}
+
+func TestZabbixAgentQuery(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	agent := NewZabbixAgent(registry)
+	registry.Collect()
+	cases := []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{"agent.ping", "1", true},
+		{"test.value", "42", true},
+		{"test.disk[sda]", "sda-1", true},
+		{`test.disk["sda"]`, "sda-1", true},
+		{"test.disk", "Invalid first parameter.", false},
+		{"test.disk[sda,1]", "Too many parameters.", false},
+		{"test.none", "Unsupported item key.", false},
+	}
+	for _, c := range cases {
+		value, ok := agent.Query(c.key)
+		if value != c.value || ok != c.ok {
+			t.Errorf("Query(%s) = %s, %v, want %s, %v", c.key, value, ok, c.value, c.ok)
+		}
+	}
+}
+
+func TestZabbixAgentPassive(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	agent := NewZabbixAgent(registry)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- agent.Serve(listener)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	WriteZabbixPacket(conn, []byte("test.value\n"))
+	data, err := ReadZabbixPacket(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "42" {
+		t.Errorf("got %q, want 42", data)
+	}
+
+	agent.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+	//重复关闭不panic
+	agent.Close()
+}
+
+func TestZabbixAgentActive(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	server := newZabbixStubServer(t, []*zabbixCheck{{Key: "test.value", Delay: "1s"}, {Key: "test.none", Delay: 1}}, false)
+	defer server.listener.Close()
+	agent := NewZabbixAgent(registry)
+	agent.Hostname = "host1"
+	done := make(chan error, 1)
+	go func() {
+		done <- agent.RunActive(server.listener.Addr().String())
+	}()
+
+	got := map[string]zabbixValue{}
+	timeout := time.After(5 * time.Second)
+	for len(got) < 2 {
+		select {
+		case v := <-server.values:
+			got[v.Key] = v
+		case <-timeout:
+			t.Fatalf("timeout, got %v", got)
+		}
+	}
+	if v := got["test.value"]; v.Value != "42" || v.Host != "host1" || v.State != 0 {
+		t.Errorf("unexpected value %+v", v)
+	}
+	if v := got["test.none"]; v.State != 1 {
+		t.Errorf("unsupported item state = %d, want 1", v.State)
+	}
+
+	agent.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("RunActive returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunActive not stopped")
+	}
+	agent.Close()
+}
+
+func TestZabbixAgentActiveFailed(t *testing.T) {
+	registry, c := newTestRegistry(t)
+	server := newZabbixStubServer(t, nil, true)
+	defer server.listener.Close()
+	agent := NewZabbixAgent(registry)
+	if err := agent.RunActive(server.listener.Addr().String()); err == nil {
+		t.Fatal("want error")
+	}
+	//第一次拉取检查项失败时不启动定时采集
+	if c.collectTimes() != 0 {
+		t.Errorf("collected %d times, want 0", c.collectTimes())
+	}
+	agent.Close()
+}